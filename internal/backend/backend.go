@@ -0,0 +1,195 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"vestri-worker/internal/docker"
+	"vestri-worker/internal/settings"
+)
+
+const (
+	RuntimeDocker = "docker"
+	RuntimePodman = "podman"
+)
+
+var (
+	ErrUnknownRuntime    = errors.New("unknown container runtime")
+	ErrServiceNotRunning = errors.New("service is not running")
+)
+
+type Project struct {
+	Name  string
+	Dir   string
+	Files []string
+}
+
+type Port struct {
+	IP          string `json:"ip,omitempty"`
+	PrivatePort int    `json:"private_port"`
+	PublicPort  int    `json:"public_port,omitempty"`
+	Protocol    string `json:"protocol"`
+}
+
+type Container struct {
+	ID        string
+	Name      string
+	Service   string
+	Image     string
+	State     string
+	Status    string
+	Health    string
+	ExitCode  int
+	Ports     []Port
+	Addresses []string
+	CreatedAt *time.Time
+	StartedAt *time.Time
+	Tty       bool
+}
+
+type UpOptions struct {
+	Services      []string
+	ForceRecreate bool
+	NoDeps        bool
+	Timeout       int
+}
+
+// DownOptions removes the whole project, or only the listed services when
+// Services is set.
+type DownOptions struct {
+	Services      []string
+	Volumes       bool
+	RemoveImages  string
+	RemoveOrphans bool
+	Timeout       int
+}
+
+type LogsOptions struct {
+	Services   []string
+	Follow     bool
+	Tail       string
+	Since      int64
+	Timestamps bool
+}
+
+type ExecOptions struct {
+	Service string
+	Command []string
+	Stdin   io.Reader
+	User    string
+	Workdir string
+	Env     []string
+}
+
+// Console is an attached service console. Reads return the combined output of
+// the container; writes go to its stdin when Writable reports true.
+type Console interface {
+	io.ReadWriteCloser
+	Tty() bool
+	Writable() bool
+}
+
+// ConfigError reports a compose configuration that the runtime rejected; Output
+// holds the diagnostics printed by the compose tool.
+type ConfigError struct {
+	Output string
+	Err    error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid compose configuration: %v", e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+type Backend interface {
+	Name() string
+	Up(ctx context.Context, p Project, opts UpOptions, out io.Writer) error
+	Down(ctx context.Context, p Project, opts DownOptions, out io.Writer) error
+	Restart(ctx context.Context, p Project, services []string, timeout int, out io.Writer) error
+	Pull(ctx context.Context, p Project, services []string, out io.Writer) error
+	Ps(ctx context.Context, p Project, out io.Writer) error
+	Config(ctx context.Context, p Project) ([]byte, string, error)
+	Services(ctx context.Context, p Project) ([]string, error)
+	Containers(ctx context.Context, p Project) ([]Container, error)
+	Projects(ctx context.Context) (map[string][]Container, error)
+	Logs(ctx context.Context, p Project, opts LogsOptions, out io.Writer) error
+	Stats(ctx context.Context, p Project, services []string) ([]ContainerStats, error)
+	Exec(ctx context.Context, p Project, opts ExecOptions, stdout, stderr io.Writer) (int, error)
+	Attach(ctx context.Context, p Project, service string) (Console, error)
+	ImageID(ctx context.Context, ref string) (string, error)
+}
+
+var (
+	current    Backend
+	currentKey string
+	override   Backend
+	mu         sync.Mutex
+)
+
+func Default() (Backend, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if override != nil {
+		return override, nil
+	}
+
+	cfg := settings.Get()
+	runtime := cfg.Runtime
+	if runtime == "" {
+		runtime = RuntimeDocker
+	}
+
+	var socket string
+	switch runtime {
+	case RuntimeDocker:
+		socket = cfg.DockerSocket
+		if socket == "" {
+			socket = docker.DefaultSocket
+		}
+	case RuntimePodman:
+		socket = cfg.PodmanSocket
+		if socket == "" {
+			socket = defaultPodmanSocket()
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRuntime, runtime)
+	}
+
+	key := runtime + "\x00" + socket
+	if current == nil || currentKey != key {
+		if runtime == RuntimePodman {
+			current = NewPodman(socket)
+		} else {
+			current = NewDockerCompose(socket)
+		}
+		currentKey = key
+	}
+	return current, nil
+}
+
+// SetDefault replaces the configured backend, e.g. with a Fake in tests. Passing
+// nil restores the backend selected by settings.
+func SetDefault(b Backend) {
+	mu.Lock()
+	override = b
+	mu.Unlock()
+}
+
+func defaultPodmanSocket() string {
+	if os.Getuid() != 0 {
+		if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+			return filepath.Join(dir, "podman", "podman.sock")
+		}
+	}
+	return "/run/podman/podman.sock"
+}
@@ -0,0 +1,195 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+type composeCLI struct {
+	binary string
+	args   []string
+	env    []string
+}
+
+func (c composeCLI) command(ctx context.Context, p Project, args ...string) *exec.Cmd {
+	// The project directory and name are always given, so compose files in
+	// subdirectories do not change the working_dir label or the project the
+	// containers belong to.
+	cmdArgs := append([]string{}, c.args...)
+	cmdArgs = append(cmdArgs, "--project-directory", p.Dir, "-p", composeProjectName(p.Name))
+	for _, file := range p.Files {
+		cmdArgs = append(cmdArgs, "-f", file)
+	}
+	cmdArgs = append(cmdArgs, args...)
+
+	cmd := exec.CommandContext(ctx, c.binary, cmdArgs...)
+	cmd.Dir = p.Dir
+	if len(c.env) > 0 {
+		cmd.Env = append(os.Environ(), c.env...)
+	}
+	return cmd
+}
+
+// composeProjectName normalizes name the way compose does for a directory
+// name, since -p only accepts lowercase names starting with a letter or digit.
+func composeProjectName(name string) string {
+	return strings.TrimLeft(strings.ToLower(name), "_-")
+}
+
+func (c composeCLI) run(ctx context.Context, p Project, out io.Writer, args ...string) error {
+	cmd := c.command(ctx, p, args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	return cmd.Run()
+}
+
+func (c composeCLI) output(ctx context.Context, p Project, args ...string) ([]byte, error) {
+	stdout, stderr, err := runCommand(c.command(ctx, p, args...))
+	if err != nil {
+		if msg := strings.TrimSpace(string(stderr)); msg != "" {
+			return stdout, fmt.Errorf("%w: %s", err, msg)
+		}
+		return stdout, err
+	}
+	return stdout, nil
+}
+
+func (c composeCLI) up(ctx context.Context, p Project, opts UpOptions, out io.Writer) error {
+	args := []string{"up", "-d"}
+	if opts.ForceRecreate {
+		args = append(args, "--force-recreate")
+	}
+	if opts.NoDeps {
+		args = append(args, "--no-deps")
+	}
+	if opts.Timeout > 0 {
+		args = append(args, "--timeout", strconv.Itoa(opts.Timeout))
+	}
+	args = append(args, opts.Services...)
+	return c.run(ctx, p, out, args...)
+}
+
+func (c composeCLI) down(ctx context.Context, p Project, opts DownOptions, out io.Writer) error {
+	if len(opts.Services) > 0 {
+		return c.removeServices(ctx, p, opts, out)
+	}
+
+	args := []string{"down"}
+	if opts.RemoveOrphans {
+		args = append(args, "--remove-orphans")
+	}
+	if opts.Volumes {
+		args = append(args, "--volumes")
+	}
+	if opts.RemoveImages != "" {
+		args = append(args, "--rmi", opts.RemoveImages)
+	}
+	if opts.Timeout > 0 {
+		args = append(args, "--timeout", strconv.Itoa(opts.Timeout))
+	}
+	return c.run(ctx, p, out, args...)
+}
+
+// removeServices stops and removes single services, leaving networks and the
+// rest of the project in place.
+func (c composeCLI) removeServices(ctx context.Context, p Project, opts DownOptions, out io.Writer) error {
+	args := []string{"stop"}
+	if opts.Timeout > 0 {
+		args = append(args, "--timeout", strconv.Itoa(opts.Timeout))
+	}
+	if err := c.run(ctx, p, out, append(args, opts.Services...)...); err != nil {
+		return err
+	}
+
+	args = []string{"rm", "--force"}
+	if opts.Volumes {
+		args = append(args, "--volumes")
+	}
+	return c.run(ctx, p, out, append(args, opts.Services...)...)
+}
+
+func (c composeCLI) restart(ctx context.Context, p Project, services []string, timeout int, out io.Writer) error {
+	args := []string{"restart"}
+	if timeout > 0 {
+		args = append(args, "--timeout", strconv.Itoa(timeout))
+	}
+	return c.run(ctx, p, out, append(args, services...)...)
+}
+
+func (c composeCLI) pull(ctx context.Context, p Project, services []string, out io.Writer) error {
+	return c.run(ctx, p, out, append([]string{"pull"}, services...)...)
+}
+
+func (c composeCLI) config(ctx context.Context, p Project) ([]byte, string, error) {
+	stdout, stderr, err := runCommand(c.command(ctx, p, "config", "--format", "json"))
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, string(stderr), &ConfigError{Output: string(stderr), Err: err}
+		}
+		return nil, string(stderr), err
+	}
+	return stdout, string(stderr), nil
+}
+
+func (c composeCLI) services(ctx context.Context, p Project) ([]string, error) {
+	out, err := c.output(ctx, p, "config", "--services")
+	if err != nil {
+		return nil, err
+	}
+	var services []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			services = append(services, line)
+		}
+	}
+	return services, nil
+}
+
+// exec runs a command in a service container and returns its exit code. A
+// non-zero exit is not an error; err is only set when compose could not run.
+func (c composeCLI) exec(ctx context.Context, p Project, opts ExecOptions, stdout, stderr io.Writer) (int, error) {
+	args := []string{"exec", "-T"}
+	if opts.User != "" {
+		args = append(args, "--user", opts.User)
+	}
+	if opts.Workdir != "" {
+		args = append(args, "--workdir", opts.Workdir)
+	}
+	for _, env := range opts.Env {
+		args = append(args, "--env", env)
+	}
+	args = append(args, opts.Service)
+	args = append(args, opts.Command...)
+
+	cmd := c.command(ctx, p, args...)
+	cmd.Stdin = opts.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+func runCommand(cmd *exec.Cmd) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
@@ -0,0 +1,26 @@
+package backend
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestComposeCommandProject(t *testing.T) {
+	cli := composeCLI{binary: "docker", args: []string{"compose"}}
+	p := Project{Name: "Game", Dir: "/srv/stacks/Game", Files: []string{"/srv/stacks/Game/deploy/compose.yaml"}}
+
+	cmd := cli.command(context.Background(), p, "ps")
+	want := []string{
+		"docker", "compose",
+		"--project-directory", "/srv/stacks/Game", "-p", "game",
+		"-f", "/srv/stacks/Game/deploy/compose.yaml",
+		"ps",
+	}
+	if !slices.Equal(cmd.Args, want) {
+		t.Errorf("args = %q, want %q", cmd.Args, want)
+	}
+	if cmd.Dir != p.Dir {
+		t.Errorf("dir = %q, want %q", cmd.Dir, p.Dir)
+	}
+}
@@ -0,0 +1,86 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"vestri-worker/internal/docker"
+)
+
+type engineConsole struct {
+	conn     *docker.HijackedConn
+	output   io.Reader
+	tty      bool
+	writable bool
+}
+
+func (b *engineBackend) Attach(ctx context.Context, p Project, service string) (Console, error) {
+	containers, err := b.Containers(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var target *Container
+	for _, c := range filterServices(containers, []string{service}) {
+		if c.State == "running" {
+			target = &c
+			break
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotRunning, service)
+	}
+
+	info, err := b.client.InspectContainer(ctx, target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := b.client.Attach(ctx, target.ID, docker.AttachOptions{
+		Stdin:  info.Config.OpenStdin,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	console := &engineConsole{
+		conn:     conn,
+		output:   conn,
+		tty:      info.Config.Tty,
+		writable: info.Config.OpenStdin,
+	}
+	if !console.tty {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(docker.Demux(pw, pw, conn))
+		}()
+		console.output = pr
+	}
+	return console, nil
+}
+
+func (c *engineConsole) Read(p []byte) (int, error) {
+	return c.output.Read(p)
+}
+
+func (c *engineConsole) Write(p []byte) (int, error) {
+	if !c.writable {
+		return 0, fmt.Errorf("console stdin is not open")
+	}
+	return c.conn.Write(p)
+}
+
+func (c *engineConsole) Close() error {
+	return c.conn.Close()
+}
+
+func (c *engineConsole) Tty() bool {
+	return c.tty
+}
+
+func (c *engineConsole) Writable() bool {
+	return c.writable
+}
@@ -0,0 +1,257 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"vestri-worker/internal/docker"
+)
+
+// engineBackend drives stacks through a compose CLI and reads container state
+// from a Docker-compatible Engine API socket.
+type engineBackend struct {
+	name   string
+	cli    composeCLI
+	client *docker.Client
+}
+
+func NewDockerCompose(socket string) Backend {
+	var env []string
+	if socket != docker.DefaultSocket {
+		env = []string{"DOCKER_HOST=unix://" + socket}
+	}
+	return &engineBackend{
+		name:   RuntimeDocker,
+		cli:    composeCLI{binary: "docker", args: []string{"compose"}, env: env},
+		client: docker.NewClient(socket),
+	}
+}
+
+func NewPodman(socket string) Backend {
+	return &engineBackend{
+		name: RuntimePodman,
+		cli: composeCLI{
+			binary: "podman",
+			args:   []string{"compose"},
+			env:    []string{"DOCKER_HOST=unix://" + socket, "CONTAINER_HOST=unix://" + socket},
+		},
+		client: docker.NewClient(socket),
+	}
+}
+
+func (b *engineBackend) Name() string {
+	return b.name
+}
+
+func (b *engineBackend) Up(ctx context.Context, p Project, opts UpOptions, out io.Writer) error {
+	return b.cli.up(ctx, p, opts, out)
+}
+
+func (b *engineBackend) Down(ctx context.Context, p Project, opts DownOptions, out io.Writer) error {
+	return b.cli.down(ctx, p, opts, out)
+}
+
+func (b *engineBackend) Restart(ctx context.Context, p Project, services []string, timeout int, out io.Writer) error {
+	return b.cli.restart(ctx, p, services, timeout, out)
+}
+
+func (b *engineBackend) Pull(ctx context.Context, p Project, services []string, out io.Writer) error {
+	return b.cli.pull(ctx, p, services, out)
+}
+
+func (b *engineBackend) Ps(ctx context.Context, p Project, out io.Writer) error {
+	return b.cli.run(ctx, p, out, "ps", "--all")
+}
+
+func (b *engineBackend) Config(ctx context.Context, p Project) ([]byte, string, error) {
+	return b.cli.config(ctx, p)
+}
+
+func (b *engineBackend) Services(ctx context.Context, p Project) ([]string, error) {
+	return b.cli.services(ctx, p)
+}
+
+func (b *engineBackend) Containers(ctx context.Context, p Project) ([]Container, error) {
+	list, err := b.client.ProjectContainers(ctx, p.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	containers := make([]Container, 0, len(list))
+	for _, c := range list {
+		container := fromDocker(c)
+		if info, err := b.client.InspectContainer(ctx, c.ID); err == nil {
+			container.ExitCode = info.State.ExitCode
+			container.StartedAt = parseTime(info.State.StartedAt)
+			container.Tty = info.Config.Tty
+			if info.State.Health != nil {
+				container.Health = info.State.Health.Status
+			}
+		}
+		containers = append(containers, container)
+	}
+	sortContainers(containers)
+	return containers, nil
+}
+
+func (b *engineBackend) Projects(ctx context.Context) (map[string][]Container, error) {
+	list, err := b.client.ListContainers(ctx, docker.ListOptions{
+		All:    true,
+		Labels: []string{docker.LabelProject},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	projects := make(map[string][]Container)
+	for _, c := range list {
+		dir := c.Labels[docker.LabelWorkingDir]
+		if dir == "" {
+			continue
+		}
+		dir = filepath.Clean(dir)
+		projects[dir] = append(projects[dir], fromDocker(c))
+	}
+	return projects, nil
+}
+
+func (b *engineBackend) Logs(ctx context.Context, p Project, opts LogsOptions, out io.Writer) error {
+	containers, err := b.Containers(ctx, p)
+	if err != nil {
+		return err
+	}
+	containers = filterServices(containers, opts.Services)
+
+	width := 0
+	for _, c := range containers {
+		if len(c.Name) > width {
+			width = len(c.Name)
+		}
+	}
+
+	logOpts := docker.LogsOptions{
+		Follow:     opts.Follow,
+		Tail:       opts.Tail,
+		Since:      opts.Since,
+		Timestamps: opts.Timestamps,
+	}
+	shared := &lockedWriter{w: out}
+	copyLogs := func(c Container) error {
+		body, err := b.client.ContainerLogs(ctx, c.ID, logOpts)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+
+		prefixed := &prefixWriter{out: shared, prefix: fmt.Sprintf("%-*s | ", width, c.Name)}
+		defer prefixed.Flush()
+		if c.Tty {
+			_, err = io.Copy(prefixed, body)
+			return err
+		}
+		return docker.Demux(prefixed, prefixed, body)
+	}
+
+	if !opts.Follow {
+		for _, c := range containers {
+			if err := copyLogs(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(containers))
+	for _, c := range containers {
+		wg.Add(1)
+		go func(c Container) {
+			defer wg.Done()
+			errs <- copyLogs(c)
+		}(c)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *engineBackend) Exec(ctx context.Context, p Project, opts ExecOptions, stdout, stderr io.Writer) (int, error) {
+	return b.cli.exec(ctx, p, opts, stdout, stderr)
+}
+
+func (b *engineBackend) ImageID(ctx context.Context, ref string) (string, error) {
+	info, err := b.client.InspectImage(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	return info.ID, nil
+}
+
+func fromDocker(c docker.Container) Container {
+	ports := make([]Port, 0, len(c.Ports))
+	for _, p := range c.Ports {
+		ports = append(ports, Port{
+			IP:          p.IP,
+			PrivatePort: p.PrivatePort,
+			PublicPort:  p.PublicPort,
+			Protocol:    p.Type,
+		})
+	}
+	created := time.Unix(c.Created, 0).UTC()
+	return Container{
+		ID:        c.ID,
+		Name:      c.Name(),
+		Service:   c.Labels[docker.LabelService],
+		Image:     c.Image,
+		State:     c.State,
+		Status:    c.Status,
+		Ports:     ports,
+		Addresses: c.Addresses(),
+		CreatedAt: &created,
+	}
+}
+
+func parseTime(value string) *time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil || t.IsZero() || t.Year() <= 1 {
+		return nil
+	}
+	return &t
+}
+
+func sortContainers(containers []Container) {
+	sort.Slice(containers, func(i, j int) bool {
+		if containers[i].Service != containers[j].Service {
+			return containers[i].Service < containers[j].Service
+		}
+		return containers[i].Name < containers[j].Name
+	})
+}
+
+func filterServices(containers []Container, services []string) []Container {
+	if len(services) == 0 {
+		return containers
+	}
+	wanted := make(map[string]bool, len(services))
+	for _, service := range services {
+		wanted[service] = true
+	}
+	filtered := make([]Container, 0, len(containers))
+	for _, c := range containers {
+		if wanted[c.Service] {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
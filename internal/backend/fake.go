@@ -0,0 +1,406 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errFakeProject = errors.New("unknown project")
+
+// Fake is an in-memory Backend for tests. Projects are registered with
+// AddProject and keyed by their directory.
+type Fake struct {
+	mu       sync.Mutex
+	projects map[string]*fakeProject
+	images   map[string]string
+	staged   map[string]string
+	calls    []string
+	serial   int
+}
+
+type fakeProject struct {
+	services   map[string]string
+	containers map[string]*Container
+	logs       map[string][]string
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		projects: make(map[string]*fakeProject),
+		images:   make(map[string]string),
+		staged:   make(map[string]string),
+	}
+}
+
+func (f *Fake) AddProject(dir string, services map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	project := &fakeProject{
+		services:   make(map[string]string, len(services)),
+		containers: make(map[string]*Container),
+		logs:       make(map[string][]string),
+	}
+	for service, image := range services {
+		project.services[service] = image
+	}
+	f.projects[dir] = project
+}
+
+func (f *Fake) SetImage(ref, id string) {
+	f.mu.Lock()
+	f.images[ref] = id
+	f.mu.Unlock()
+}
+
+// StageImage makes the next Pull replace ref with id.
+func (f *Fake) StageImage(ref, id string) {
+	f.mu.Lock()
+	f.staged[ref] = id
+	f.mu.Unlock()
+}
+
+func (f *Fake) AppendLog(dir, service, line string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if project, ok := f.projects[dir]; ok {
+		project.logs[service] = append(project.logs[service], line)
+	}
+}
+
+func (f *Fake) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) project(p Project, op string) (*fakeProject, error) {
+	f.calls = append(f.calls, op+" "+p.Dir)
+	project, ok := f.projects[p.Dir]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errFakeProject, p.Dir)
+	}
+	return project, nil
+}
+
+func (f *Fake) Up(ctx context.Context, p Project, opts UpOptions, out io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	project, err := f.project(p, "up")
+	if err != nil {
+		return err
+	}
+	for _, service := range project.selected(opts.Services) {
+		c, ok := project.containers[service]
+		if !ok || opts.ForceRecreate {
+			f.serial++
+			now := time.Now().UTC()
+			c = &Container{
+				ID:        fmt.Sprintf("fake%012d", f.serial),
+				Name:      fmt.Sprintf("%s-%s-1", p.Name, service),
+				Service:   service,
+				Image:     project.services[service],
+				Ports:     []Port{},
+				CreatedAt: &now,
+			}
+			project.containers[service] = c
+		}
+		now := time.Now().UTC()
+		c.State = "running"
+		c.Status = "Up"
+		c.StartedAt = &now
+		fmt.Fprintf(out, "Container %s Started\n", c.Name)
+	}
+	return nil
+}
+
+func (f *Fake) Down(ctx context.Context, p Project, opts DownOptions, out io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	project, err := f.project(p, "down")
+	if err != nil {
+		return err
+	}
+	for service, c := range project.containers {
+		if len(opts.Services) > 0 && !slices.Contains(opts.Services, service) {
+			continue
+		}
+		fmt.Fprintf(out, "Container %s Removed\n", c.Name)
+		delete(project.containers, service)
+	}
+	return nil
+}
+
+func (f *Fake) Restart(ctx context.Context, p Project, services []string, timeout int, out io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	project, err := f.project(p, "restart")
+	if err != nil {
+		return err
+	}
+	for _, c := range filterServices(project.list(), services) {
+		container := project.containers[c.Service]
+		now := time.Now().UTC()
+		container.State = "running"
+		container.Status = "Up"
+		container.StartedAt = &now
+		fmt.Fprintf(out, "Container %s Restarted\n", c.Name)
+	}
+	return nil
+}
+
+func (f *Fake) Pull(ctx context.Context, p Project, services []string, out io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	project, err := f.project(p, "pull")
+	if err != nil {
+		return err
+	}
+	for _, service := range project.selected(services) {
+		ref := project.services[service]
+		if id, ok := f.staged[ref]; ok {
+			f.images[ref] = id
+			delete(f.staged, ref)
+		}
+		fmt.Fprintf(out, "%s Pulled\n", service)
+	}
+	return nil
+}
+
+func (f *Fake) Ps(ctx context.Context, p Project, out io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	project, err := f.project(p, "ps")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "NAME\tSERVICE\tSTATE")
+	for _, c := range project.list() {
+		fmt.Fprintf(out, "%s\t%s\t%s\n", c.Name, c.Service, c.State)
+	}
+	return nil
+}
+
+func (f *Fake) Config(ctx context.Context, p Project) ([]byte, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	project, err := f.project(p, "config")
+	if err != nil {
+		return nil, err.Error(), &ConfigError{Output: err.Error(), Err: err}
+	}
+
+	services := make(map[string]map[string]any, len(project.services))
+	for service, image := range project.services {
+		services[service] = map[string]any{"image": image}
+	}
+	data, err := json.Marshal(map[string]any{"name": p.Name, "services": services})
+	return data, "", err
+}
+
+func (f *Fake) Services(ctx context.Context, p Project) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	project, err := f.project(p, "services")
+	if err != nil {
+		return nil, err
+	}
+	return project.selected(nil), nil
+}
+
+func (f *Fake) Containers(ctx context.Context, p Project) ([]Container, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	project, ok := f.projects[p.Dir]
+	if !ok {
+		return []Container{}, nil
+	}
+	return project.list(), nil
+}
+
+func (f *Fake) Projects(ctx context.Context) (map[string][]Container, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := make(map[string][]Container, len(f.projects))
+	for dir, project := range f.projects {
+		if containers := project.list(); len(containers) > 0 {
+			result[dir] = containers
+		}
+	}
+	return result, nil
+}
+
+func (f *Fake) Logs(ctx context.Context, p Project, opts LogsOptions, out io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	project, err := f.project(p, "logs")
+	if err != nil {
+		return err
+	}
+	for _, c := range filterServices(project.list(), opts.Services) {
+		for _, line := range project.logs[c.Service] {
+			fmt.Fprintf(out, "%s | %s\n", c.Name, line)
+		}
+	}
+	return nil
+}
+
+func (f *Fake) Stats(ctx context.Context, p Project, services []string) ([]ContainerStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	project, err := f.project(p, "stats")
+	if err != nil {
+		return nil, err
+	}
+	stats := []ContainerStats{}
+	for _, c := range filterServices(project.list(), services) {
+		if c.State != "running" {
+			continue
+		}
+		stats = append(stats, ContainerStats{
+			ID:      c.ID,
+			Name:    c.Name,
+			Service: c.Service,
+			Read:    time.Now().UTC(),
+			Pids:    1,
+		})
+	}
+	return stats, nil
+}
+
+// Exec echoes the command to stdout and copies stdin through. The command
+// "false" exits with status 1.
+func (f *Fake) Exec(ctx context.Context, p Project, opts ExecOptions, stdout, stderr io.Writer) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	project, err := f.project(p, "exec")
+	if err != nil {
+		return -1, err
+	}
+	c, ok := project.containers[opts.Service]
+	if !ok || c.State != "running" {
+		fmt.Fprintf(stderr, "service %q is not running\n", opts.Service)
+		return 1, nil
+	}
+	if len(opts.Command) > 0 && opts.Command[0] == "false" {
+		return 1, nil
+	}
+	fmt.Fprintln(stdout, strings.Join(opts.Command, " "))
+	if opts.Stdin != nil {
+		if _, err := io.Copy(stdout, opts.Stdin); err != nil {
+			return -1, err
+		}
+	}
+	return 0, nil
+}
+
+// Attach returns a console that replays the service log and echoes every
+// line written to it.
+func (f *Fake) Attach(ctx context.Context, p Project, service string) (Console, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	project, err := f.project(p, "attach")
+	if err != nil {
+		return nil, err
+	}
+	c, ok := project.containers[service]
+	if !ok || c.State != "running" {
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotRunning, service)
+	}
+
+	pr, pw := io.Pipe()
+	console := &fakeConsole{PipeReader: pr, out: pw}
+	backlog := append([]string(nil), project.logs[service]...)
+	go func() {
+		for _, line := range backlog {
+			if _, err := fmt.Fprintln(pw, line); err != nil {
+				return
+			}
+		}
+	}()
+	return console, nil
+}
+
+func (f *Fake) ImageID(ctx context.Context, ref string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id, ok := f.images[ref]
+	if !ok {
+		return "", fmt.Errorf("no such image: %s", ref)
+	}
+	return id, nil
+}
+
+func (p *fakeProject) selected(services []string) []string {
+	if len(services) > 0 {
+		return services
+	}
+	all := make([]string, 0, len(p.services))
+	for service := range p.services {
+		all = append(all, service)
+	}
+	sort.Strings(all)
+	return all
+}
+
+func (p *fakeProject) list() []Container {
+	containers := make([]Container, 0, len(p.containers))
+	for _, c := range p.containers {
+		containers = append(containers, *c)
+	}
+	sortContainers(containers)
+	return containers
+}
+
+type fakeConsole struct {
+	*io.PipeReader
+	mu  sync.Mutex
+	out *io.PipeWriter
+}
+
+func (c *fakeConsole) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := fmt.Fprintf(c.out, "> %s", p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *fakeConsole) Close() error {
+	c.out.Close()
+	return c.PipeReader.Close()
+}
+
+func (c *fakeConsole) Tty() bool {
+	return false
+}
+
+func (c *fakeConsole) Writable() bool {
+	return true
+}
@@ -0,0 +1,131 @@
+package backend
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"vestri-worker/internal/docker"
+)
+
+type ContainerStats struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Service       string    `json:"service"`
+	Read          time.Time `json:"read"`
+	CPUPercent    float64   `json:"cpu_percent"`
+	MemoryUsage   uint64    `json:"memory_usage_bytes"`
+	MemoryLimit   uint64    `json:"memory_limit_bytes"`
+	MemoryPercent float64   `json:"memory_percent"`
+	NetworkRx     uint64    `json:"network_rx_bytes"`
+	NetworkTx     uint64    `json:"network_tx_bytes"`
+	BlockRead     uint64    `json:"block_read_bytes"`
+	BlockWrite    uint64    `json:"block_write_bytes"`
+	Pids          uint64    `json:"pids"`
+}
+
+func (b *engineBackend) Stats(ctx context.Context, p Project, services []string) ([]ContainerStats, error) {
+	containers, err := b.Containers(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	containers = filterServices(containers, services)
+
+	var running []Container
+	for _, c := range containers {
+		if c.State == "running" {
+			running = append(running, c)
+		}
+	}
+
+	stats := make([]ContainerStats, len(running))
+	errs := make([]error, len(running))
+	var wg sync.WaitGroup
+	for i, c := range running {
+		wg.Add(1)
+		go func(i int, c Container) {
+			defer wg.Done()
+			raw, err := b.client.ContainerStats(ctx, c.ID)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			stats[i] = fromDockerStats(c, raw)
+		}(i, c)
+	}
+	wg.Wait()
+
+	result := make([]ContainerStats, 0, len(running))
+	for i := range running {
+		if errs[i] != nil {
+			if docker.IsNotFound(errs[i]) {
+				continue
+			}
+			return nil, errs[i]
+		}
+		result = append(result, stats[i])
+	}
+	return result, nil
+}
+
+// fromDockerStats derives the figures shown by `docker stats` from a raw
+// Engine API sample.
+func fromDockerStats(c Container, raw docker.Stats) ContainerStats {
+	stats := ContainerStats{
+		ID:          c.ID,
+		Name:        c.Name,
+		Service:     c.Service,
+		Read:        raw.Read,
+		CPUPercent:  cpuPercent(raw),
+		MemoryUsage: memoryUsage(raw.MemoryStats),
+		MemoryLimit: raw.MemoryStats.Limit,
+		Pids:        raw.PidsStats.Current,
+	}
+	if stats.MemoryLimit > 0 {
+		stats.MemoryPercent = float64(stats.MemoryUsage) / float64(stats.MemoryLimit) * 100
+	}
+	for _, network := range raw.Networks {
+		stats.NetworkRx += network.RxBytes
+		stats.NetworkTx += network.TxBytes
+	}
+	for _, entry := range raw.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			stats.BlockRead += entry.Value
+		case "write":
+			stats.BlockWrite += entry.Value
+		}
+	}
+	return stats
+}
+
+func cpuPercent(raw docker.Stats) float64 {
+	cpuDelta := float64(raw.CPUStats.CPUUsage.TotalUsage) - float64(raw.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(raw.CPUStats.SystemUsage) - float64(raw.PreCPUStats.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+
+	cpus := float64(raw.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(raw.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpus == 0 {
+		cpus = 1
+	}
+	return cpuDelta / systemDelta * cpus * 100
+}
+
+func memoryUsage(mem docker.MemoryStats) uint64 {
+	// Page cache is reclaimable, so it is excluded like `docker stats` does:
+	// total_inactive_file on cgroup v1, inactive_file on cgroup v2.
+	cache, ok := mem.Stats["total_inactive_file"]
+	if !ok {
+		cache = mem.Stats["inactive_file"]
+	}
+	if cache < mem.Usage {
+		return mem.Usage - cache
+	}
+	return mem.Usage
+}
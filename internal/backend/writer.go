@@ -0,0 +1,49 @@
+package backend
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+type prefixWriter struct {
+	out     io.Writer
+	prefix  string
+	partial []byte
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.partial = append(p.partial, data...)
+	for {
+		idx := bytes.IndexByte(p.partial, '\n')
+		if idx < 0 {
+			break
+		}
+		line := append([]byte(p.prefix), p.partial[:idx+1]...)
+		if _, err := p.out.Write(line); err != nil {
+			return len(data), err
+		}
+		p.partial = p.partial[idx+1:]
+	}
+	return len(data), nil
+}
+
+func (p *prefixWriter) Flush() {
+	if len(p.partial) == 0 {
+		return
+	}
+	line := append([]byte(p.prefix), p.partial...)
+	p.out.Write(append(line, '\n'))
+	p.partial = nil
+}
@@ -0,0 +1,99 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+type AttachOptions struct {
+	Stdin  bool
+	Stdout bool
+	Stderr bool
+	Logs   bool
+}
+
+// HijackedConn is a raw attach stream. Output is multiplexed (see Demux)
+// unless the container was started with a TTY.
+type HijackedConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (h *HijackedConn) Read(p []byte) (int, error) {
+	return h.reader.Read(p)
+}
+
+func (h *HijackedConn) Write(p []byte) (int, error) {
+	return h.conn.Write(p)
+}
+
+// CloseWrite signals end of input to the container.
+func (h *HijackedConn) CloseWrite() error {
+	if cw, ok := h.conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+func (h *HijackedConn) Close() error {
+	return h.conn.Close()
+}
+
+// Attach connects to a container's stdio. The HTTP connection is upgraded and
+// handed back to the caller, who must close it.
+func (c *Client) Attach(ctx context.Context, id string, opts AttachOptions) (*HijackedConn, error) {
+	query := url.Values{"stream": {"1"}}
+	if opts.Stdin {
+		query.Set("stdin", "1")
+	}
+	if opts.Stdout {
+		query.Set("stdout", "1")
+	}
+	if opts.Stderr {
+		query.Set("stderr", "1")
+	}
+	if opts.Logs {
+		query.Set("logs", "1")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/attach", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "unix", c.socket)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	if err := req.Write(conn); err != nil {
+		stop()
+		conn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		stop()
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		defer conn.Close()
+		stop()
+		return nil, readAPIError(resp)
+	}
+	if !stop() {
+		return nil, ctx.Err()
+	}
+
+	return &HijackedConn{conn: conn, reader: reader}, nil
+}
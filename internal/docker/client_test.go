@@ -0,0 +1,189 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// newTestClient serves handler on a unix socket in a temporary directory and
+// returns a client talking to it.
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener.Close()
+	server.Listener = ln
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return NewClient(socket)
+}
+
+func frame(stream byte, data string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+	return append(header, data...)
+}
+
+func TestListProjectContainers(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+apiVersion+"/containers/json" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("all") != "1" {
+			t.Errorf("all = %q, want 1", r.URL.Query().Get("all"))
+		}
+		var filters map[string][]string
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters); err != nil {
+			t.Errorf("filters: %v", err)
+		}
+		want := LabelWorkingDir + "=/srv/game"
+		if len(filters["label"]) != 1 || filters["label"][0] != want {
+			t.Errorf("label filter = %v, want %s", filters["label"], want)
+		}
+
+		json.NewEncoder(w).Encode([]map[string]any{{
+			"Id":     "abc",
+			"Names":  []string{"/game-app-1"},
+			"Image":  "nginx",
+			"State":  "running",
+			"Labels": map[string]string{LabelService: "app"},
+			"Ports":  []map[string]any{{"PrivatePort": 80, "PublicPort": 8080, "Type": "tcp"}},
+		}})
+	}))
+
+	containers, err := client.ProjectContainers(context.Background(), "/srv/game")
+	if err != nil {
+		t.Fatalf("ProjectContainers: %v", err)
+	}
+	if len(containers) != 1 {
+		t.Fatalf("got %d containers, want 1", len(containers))
+	}
+	c := containers[0]
+	if c.Name() != "game-app-1" || c.State != "running" || c.Labels[LabelService] != "app" {
+		t.Errorf("unexpected container %+v", c)
+	}
+	if len(c.Ports) != 1 || c.Ports[0].PublicPort != 8080 {
+		t.Errorf("ports = %+v", c.Ports)
+	}
+}
+
+func TestInspectContainerStatus(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + apiVersion + "/containers/abc/json":
+			json.NewEncoder(w).Encode(map[string]any{
+				"Id":   "abc",
+				"Name": "/game-app-1",
+				"State": map[string]any{
+					"Status":    "exited",
+					"ExitCode":  137,
+					"StartedAt": "2024-01-02T03:04:05Z",
+					"Health":    map[string]any{"Status": "unhealthy"},
+				},
+				"Config": map[string]any{"Tty": true, "OpenStdin": true},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message":"No such container: missing"}`)
+		}
+	}))
+
+	info, err := client.InspectContainer(context.Background(), "abc")
+	if err != nil {
+		t.Fatalf("InspectContainer: %v", err)
+	}
+	if info.State.Status != "exited" || info.State.ExitCode != 137 {
+		t.Errorf("state = %+v", info.State)
+	}
+	if info.State.Health == nil || info.State.Health.Status != "unhealthy" {
+		t.Errorf("health = %+v", info.State.Health)
+	}
+	if !info.Config.Tty || !info.Config.OpenStdin {
+		t.Errorf("config = %+v", info.Config)
+	}
+
+	_, err = client.InspectContainer(context.Background(), "missing")
+	if !IsNotFound(err) {
+		t.Fatalf("err = %v, want not found", err)
+	}
+	if apiErr := err.(*APIError); apiErr.Message != "No such container: missing" {
+		t.Errorf("message = %q", apiErr.Message)
+	}
+}
+
+func TestContainerLogsDemux(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("follow") != "" || query.Get("tail") != "10" || query.Get("timestamps") != "1" {
+			t.Errorf("query = %v", query)
+		}
+		w.Write(frame(streamStdout, "hello\n"))
+		w.Write(frame(streamStderr, "oops\n"))
+		w.Write(frame(streamStdout, "bye\n"))
+	}))
+
+	body, err := client.ContainerLogs(context.Background(), "abc", LogsOptions{Tail: "10", Timestamps: true})
+	if err != nil {
+		t.Fatalf("ContainerLogs: %v", err)
+	}
+	defer body.Close()
+
+	var stdout, stderr bytes.Buffer
+	if err := Demux(&stdout, &stderr, body); err != nil {
+		t.Fatalf("Demux: %v", err)
+	}
+	if stdout.String() != "hello\nbye\n" {
+		t.Errorf("stdout = %q", stdout.String())
+	}
+	if stderr.String() != "oops\n" {
+		t.Errorf("stderr = %q", stderr.String())
+	}
+}
+
+func TestDemuxRejectsInvalidStream(t *testing.T) {
+	err := Demux(io.Discard, io.Discard, bytes.NewReader(frame(7, "x")))
+	if err == nil {
+		t.Fatal("expected an error for stream type 7")
+	}
+}
+
+func TestInspectImage(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+apiVersion+"/images/nginx:1.25/json" {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"message":"no such image"}`)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"Id":       "sha256:1234",
+			"RepoTags": []string{"nginx:1.25"},
+		})
+	}))
+
+	info, err := client.InspectImage(context.Background(), "nginx:1.25")
+	if err != nil {
+		t.Fatalf("InspectImage: %v", err)
+	}
+	if info.ID != "sha256:1234" || len(info.RepoTags) != 1 {
+		t.Errorf("image = %+v", info)
+	}
+
+	if _, err := client.InspectImage(context.Background(), "missing"); !IsNotFound(err) {
+		t.Errorf("err = %v, want not found", err)
+	}
+}
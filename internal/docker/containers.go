@@ -0,0 +1,148 @@
+package docker
+
+import (
+	"context"
+	"net/url"
+)
+
+const (
+	LabelProject    = "com.docker.compose.project"
+	LabelService    = "com.docker.compose.service"
+	LabelWorkingDir = "com.docker.compose.project.working_dir"
+	LabelNumber     = "com.docker.compose.container-number"
+)
+
+type Port struct {
+	IP          string `json:"IP"`
+	PrivatePort int    `json:"PrivatePort"`
+	PublicPort  int    `json:"PublicPort"`
+	Type        string `json:"Type"`
+}
+
+type Container struct {
+	ID      string            `json:"Id"`
+	Names   []string          `json:"Names"`
+	Image   string            `json:"Image"`
+	ImageID string            `json:"ImageID"`
+	Created int64             `json:"Created"`
+	State   string            `json:"State"`
+	Status  string            `json:"Status"`
+	Labels  map[string]string `json:"Labels"`
+	Ports   []Port            `json:"Ports"`
+
+	NetworkSettings ContainerNetworks `json:"NetworkSettings"`
+}
+
+type ContainerNetworks struct {
+	Networks map[string]EndpointSettings `json:"Networks"`
+}
+
+type EndpointSettings struct {
+	IPAddress         string `json:"IPAddress"`
+	GlobalIPv6Address string `json:"GlobalIPv6Address"`
+}
+
+// Addresses returns the container's IP addresses on all of its networks.
+func (c Container) Addresses() []string {
+	var addrs []string
+	for _, network := range c.NetworkSettings.Networks {
+		for _, addr := range []string{network.IPAddress, network.GlobalIPv6Address} {
+			if addr != "" {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	return addrs
+}
+
+func (c Container) Name() string {
+	if len(c.Names) == 0 {
+		return ""
+	}
+	name := c.Names[0]
+	if len(name) > 0 && name[0] == '/' {
+		name = name[1:]
+	}
+	return name
+}
+
+type ContainerState struct {
+	Status     string `json:"Status"`
+	Running    bool   `json:"Running"`
+	Paused     bool   `json:"Paused"`
+	Restarting bool   `json:"Restarting"`
+	ExitCode   int    `json:"ExitCode"`
+	Error      string `json:"Error"`
+	StartedAt  string `json:"StartedAt"`
+	FinishedAt string `json:"FinishedAt"`
+	Health     *struct {
+		Status string `json:"Status"`
+	} `json:"Health"`
+}
+
+type ContainerConfig struct {
+	Image     string            `json:"Image"`
+	Labels    map[string]string `json:"Labels"`
+	Tty       bool              `json:"Tty"`
+	OpenStdin bool              `json:"OpenStdin"`
+}
+
+type ContainerJSON struct {
+	ID      string          `json:"Id"`
+	Name    string          `json:"Name"`
+	Created string          `json:"Created"`
+	Image   string          `json:"Image"`
+	State   ContainerState  `json:"State"`
+	Config  ContainerConfig `json:"Config"`
+}
+
+type ListOptions struct {
+	All    bool
+	Labels []string
+}
+
+func (c *Client) ListContainers(ctx context.Context, opts ListOptions) ([]Container, error) {
+	query := url.Values{}
+	if opts.All {
+		query.Set("all", "1")
+	}
+	if len(opts.Labels) > 0 {
+		filters, err := filtersQuery(map[string][]string{"label": opts.Labels})
+		if err != nil {
+			return nil, err
+		}
+		query.Set("filters", filters)
+	}
+
+	var containers []Container
+	if err := c.getJSON(ctx, "/containers/json", query, &containers); err != nil {
+		return nil, err
+	}
+	return containers, nil
+}
+
+func (c *Client) ProjectContainers(ctx context.Context, workingDir string) ([]Container, error) {
+	return c.ListContainers(ctx, ListOptions{
+		All:    true,
+		Labels: []string{LabelWorkingDir + "=" + workingDir},
+	})
+}
+
+func (c *Client) InspectContainer(ctx context.Context, id string) (ContainerJSON, error) {
+	var info ContainerJSON
+	err := c.getJSON(ctx, "/containers/"+url.PathEscape(id)+"/json", nil, &info)
+	return info, err
+}
+
+type ImageInspect struct {
+	ID          string   `json:"Id"`
+	RepoTags    []string `json:"RepoTags"`
+	RepoDigests []string `json:"RepoDigests"`
+	Created     string   `json:"Created"`
+}
+
+func (c *Client) InspectImage(ctx context.Context, ref string) (ImageInspect, error) {
+	var info ImageInspect
+	err := c.getJSON(ctx, "/images/"+ref+"/json", nil, &info)
+	return info, err
+}
@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type Event struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	Time     int64 `json:"time"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+type EventsOptions struct {
+	Since   int64
+	Filters map[string][]string
+}
+
+func (c *Client) Events(ctx context.Context, opts EventsOptions, fn func(Event) error) error {
+	query := url.Values{}
+	if opts.Since > 0 {
+		query.Set("since", strconv.FormatInt(opts.Since, 10))
+	}
+	if len(opts.Filters) > 0 {
+		filters, err := filtersQuery(opts.Filters)
+		if err != nil {
+			return err
+		}
+		query.Set("filters", filters)
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, "/events", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var event Event
+		if err := dec.Decode(&event); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package docker
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	streamStdin  = 0
+	streamStdout = 1
+	streamStderr = 2
+)
+
+type LogsOptions struct {
+	Follow     bool
+	Tail       string
+	Since      int64
+	Timestamps bool
+}
+
+func (c *Client) ContainerLogs(ctx context.Context, id string, opts LogsOptions) (io.ReadCloser, error) {
+	query := url.Values{
+		"stdout": {"1"},
+		"stderr": {"1"},
+	}
+	if opts.Follow {
+		query.Set("follow", "1")
+	}
+	if opts.Tail != "" {
+		query.Set("tail", opts.Tail)
+	}
+	if opts.Since > 0 {
+		query.Set("since", strconv.FormatInt(opts.Since, 10))
+	}
+	if opts.Timestamps {
+		query.Set("timestamps", "1")
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/logs", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Demux copies a multiplexed stdout/stderr stream, as produced for containers
+// without a TTY, into the given writers.
+func Demux(stdout, stderr io.Writer, src io.Reader) error {
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(src, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		var dst io.Writer
+		switch header[0] {
+		case streamStdin, streamStdout:
+			dst = stdout
+		case streamStderr:
+			dst = stderr
+		default:
+			return fmt.Errorf("invalid stream type %d", header[0])
+		}
+
+		if _, err := io.CopyN(dst, src, size); err != nil {
+			return err
+		}
+	}
+}
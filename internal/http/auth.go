@@ -7,12 +7,14 @@ import (
 	"crypto/subtle"
 	"encoding/hex"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"vestri-worker/internal/settings"
+	"vestri-worker/internal/websocket"
 )
 
 const (
@@ -20,6 +22,10 @@ const (
 	headerTimestamp  = "X-Request-Timestamp"
 	headerNonce      = "X-Request-Nonce"
 	headerSignature  = "X-Request-Signature"
+	queryTimestamp   = "timestamp"
+	queryNonce       = "nonce"
+	querySignature   = "signature"
+	queryAuthPath    = "/stack/console"
 	defaultReplayTTL = 300
 	maxNonceLength   = 128
 	maxNonceEntries  = 200000
@@ -52,15 +58,24 @@ func authMiddleware() Middleware {
 				return
 			}
 
+			var timestamp, nonce, signature string
+			uri := r.URL.RequestURI()
 			apiKey := r.Header.Get(headerAPIKey)
-			if !secureEqual(apiKey, apiKeyConfig) {
-				rejectUnauthorized(w, r, cfg)
-				return
+			if apiKey == "" && r.URL.Path == queryAuthPath && websocket.IsUpgrade(r) {
+				// Browsers cannot set headers on a WebSocket handshake, so the
+				// console's credentials travel in the query. The signature alone
+				// proves knowledge of the key, which is never put in the URL.
+				apiKey = apiKeyConfig
+				timestamp, nonce, signature, uri = queryCredentials(r.URL)
+			} else {
+				if !secureEqual(apiKey, apiKeyConfig) {
+					rejectUnauthorized(w, r, cfg)
+					return
+				}
+				timestamp = strings.TrimSpace(r.Header.Get(headerTimestamp))
+				nonce = strings.TrimSpace(r.Header.Get(headerNonce))
+				signature = strings.TrimSpace(r.Header.Get(headerSignature))
 			}
-
-			timestamp := strings.TrimSpace(r.Header.Get(headerTimestamp))
-			nonce := strings.TrimSpace(r.Header.Get(headerNonce))
-			signature := strings.TrimSpace(r.Header.Get(headerSignature))
 			if timestamp == "" || nonce == "" || signature == "" {
 				rejectUnauthorized(w, r, cfg)
 				return
@@ -88,7 +103,7 @@ func authMiddleware() Middleware {
 				return
 			}
 
-			expected := buildSignature(apiKeyConfig, timestamp, nonce, r.Method, r.URL.RequestURI())
+			expected := buildSignature(apiKeyConfig, timestamp, nonce, r.Method, uri)
 			if !secureEqual(signature, expected) {
 				rejectUnauthorized(w, r, cfg)
 				return
@@ -105,6 +120,40 @@ func authMiddleware() Middleware {
 	}
 }
 
+// queryCredentials reads the signing parameters from the query and returns the
+// request URI with them removed, which is what the client signed.
+func queryCredentials(u *url.URL) (timestamp, nonce, signature, uri string) {
+	var kept []string
+	for _, part := range strings.Split(u.RawQuery, "&") {
+		if part == "" {
+			continue
+		}
+		rawKey, rawValue, _ := strings.Cut(part, "=")
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			kept = append(kept, part)
+			continue
+		}
+		value, _ := url.QueryUnescape(rawValue)
+		switch key {
+		case queryTimestamp:
+			timestamp = strings.TrimSpace(value)
+		case queryNonce:
+			nonce = strings.TrimSpace(value)
+		case querySignature:
+			signature = strings.TrimSpace(value)
+		default:
+			kept = append(kept, part)
+		}
+	}
+
+	uri = u.EscapedPath()
+	if len(kept) > 0 {
+		uri += "?" + strings.Join(kept, "&")
+	}
+	return timestamp, nonce, signature, uri
+}
+
 func buildSignature(secret, timestamp, nonce, method, uri string) string {
 	payload := strings.Join([]string{timestamp, nonce, method, uri}, "\n")
 	mac := hmac.New(sha256.New, []byte(secret))
@@ -55,6 +55,11 @@ func ZipHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if protectedPath(base, sourcePath) || protectedPath(base, destPath) {
+		logArchiveOpError(r, "zip", req.Source, req.Dest, errProtectedPath)
+		http.Error(w, errProtectedPath.Error(), http.StatusForbidden)
+		return
+	}
 
 	sourceInfo, err := os.Lstat(sourcePath)
 	if err != nil {
@@ -86,7 +91,8 @@ func ZipHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := zipPath(sourcePath, destPath, sourceInfo); err != nil {
+	skip := func(path string) bool { return protectedPath(base, path) }
+	if err := zipPath(sourcePath, destPath, sourceInfo, skip); err != nil {
 		logArchiveOpError(r, "zip", req.Source, req.Dest, err)
 		http.Error(w, "cannot create zip", http.StatusInternalServerError)
 		return
@@ -155,8 +161,12 @@ func UnzipHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := unzipPath(sourcePath, destPath); err != nil {
+	if err := unzipPath(sourcePath, destPath, base); err != nil {
 		logArchiveOpError(r, "unzip", req.Source, req.Dest, err)
+		if errors.Is(err, errProtectedPath) {
+			http.Error(w, errProtectedPath.Error(), http.StatusForbidden)
+			return
+		}
 		http.Error(w, "cannot unzip archive", http.StatusInternalServerError)
 		return
 	}
@@ -179,7 +189,23 @@ func ensureDir(path string) error {
 	return os.MkdirAll(path, 0755)
 }
 
-func zipPath(sourcePath, destPath string, sourceInfo os.FileInfo) error {
+func ZipPath(sourcePath, destPath string) error {
+	sourceInfo, err := os.Lstat(sourcePath)
+	if err != nil {
+		return err
+	}
+	if sourceInfo.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("source is a symlink")
+	}
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return err
+	}
+	return zipPath(sourcePath, destPath, sourceInfo, nil)
+}
+
+// zipPath archives sourcePath into destPath, leaving out files for which skip
+// reports true.
+func zipPath(sourcePath, destPath string, sourceInfo os.FileInfo, skip func(string) bool) error {
 	out, err := os.Create(destPath)
 	if err != nil {
 		return err
@@ -190,13 +216,13 @@ func zipPath(sourcePath, destPath string, sourceInfo os.FileInfo) error {
 	defer zw.Close()
 
 	if sourceInfo.IsDir() {
-		return zipDir(zw, sourcePath, sourceInfo)
+		return zipDir(zw, sourcePath, sourceInfo, skip)
 	}
 
 	return zipFile(zw, sourcePath, filepath.Base(sourcePath), sourceInfo)
 }
 
-func zipDir(zw *zip.Writer, dirPath string, dirInfo os.FileInfo) error {
+func zipDir(zw *zip.Writer, dirPath string, dirInfo os.FileInfo, skip func(string) bool) error {
 	baseName := filepath.Base(dirPath)
 	if err := addZipDir(zw, baseName, dirInfo); err != nil {
 		return err
@@ -209,6 +235,9 @@ func zipDir(zw *zip.Writer, dirPath string, dirInfo os.FileInfo) error {
 		if entryPath == dirPath {
 			return nil
 		}
+		if skip != nil && skip(entryPath) {
+			return nil
+		}
 		if entry.Type()&os.ModeSymlink != 0 {
 			return fmt.Errorf("symlinks not supported")
 		}
@@ -294,7 +323,7 @@ func copyWithLimit(dst io.Writer, src io.Reader, limit int64) (int64, error) {
 	return written, nil
 }
 
-func unzipPath(zipPath, destDir string) error {
+func unzipPath(zipPath, destDir, base string) error {
 	reader, err := zip.OpenReader(zipPath)
 	if err != nil {
 		return err
@@ -328,6 +357,9 @@ func unzipPath(zipPath, destDir string) error {
 		if err := validatePathNoSymlink(destDir, targetPath); err != nil {
 			return err
 		}
+		if protectedPath(base, targetPath) {
+			return fmt.Errorf("%s: %w", file.Name, errProtectedPath)
+		}
 
 		if file.FileInfo().IsDir() {
 			if err := os.MkdirAll(targetPath, 0755); err != nil {
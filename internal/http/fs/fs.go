@@ -29,6 +29,11 @@ func ReadFileHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if protectedPath(base, fullPath) {
+		logPathOpError(r, "read", path, errProtectedPath)
+		http.Error(w, errProtectedPath.Error(), http.StatusForbidden)
+		return
+	}
 
 	data, err := os.ReadFile(fullPath)
 	if err != nil {
@@ -78,6 +83,11 @@ func WriteFileHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if protectedPath(base, fullPath) {
+		logPathOpError(r, "write", body.Path, errProtectedPath)
+		http.Error(w, errProtectedPath.Error(), http.StatusForbidden)
+		return
+	}
 
 	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
 		logPathOpError(r, "write", body.Path, err)
@@ -81,3 +81,29 @@ func validatePathNoSymlink(base, full string) error {
 
 	return nil
 }
+
+// StackMetaFileName is the per-stack metadata document. It is only written
+// through /stack/meta, so the generic endpoints refuse to touch it.
+const StackMetaFileName = "vestri.json"
+
+var errProtectedPath = errors.New("path is managed by the worker")
+
+// protectedPath reports whether full is a stack's metadata file, i.e.
+// <base>/<stack>/vestri.json. Hidden directories such as templates are not
+// stacks and stay writable.
+func protectedPath(base, full string) bool {
+	cleanBase, err := filepath.Abs(base)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(cleanBase, filepath.Clean(full))
+	if err != nil {
+		return false
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	return len(parts) == 2 && parts[1] == StackMetaFileName && !strings.HasPrefix(parts[0], ".")
+}
+
+func SafePath(base, userPath string) (string, error) {
+	return safePath(base, userPath)
+}
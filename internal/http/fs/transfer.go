@@ -32,6 +32,11 @@ func DownloadFileHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if protectedPath(base, fullPath) {
+		logPathOpError(r, "download", path, errProtectedPath)
+		http.Error(w, errProtectedPath.Error(), http.StatusForbidden)
+		return
+	}
 
 	info, err := os.Stat(fullPath)
 	if err != nil {
@@ -91,6 +96,11 @@ func UploadFileHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if protectedPath(base, fullPath) {
+		logPathOpError(r, "upload", path, errProtectedPath)
+		http.Error(w, errProtectedPath.Error(), http.StatusForbidden)
+		return
+	}
 
 	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
 		logPathOpError(r, "upload", path, err)
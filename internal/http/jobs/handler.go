@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"vestri-worker/internal/jobs"
+)
+
+func ListJobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stack := r.URL.Query().Get("stack")
+	status := jobs.Status(r.URL.Query().Get("status"))
+
+	all := jobs.Default().List()
+	result := make([]jobs.Job, 0, len(all))
+	for _, job := range all {
+		if stack != "" && job.Stack != stack {
+			continue
+		}
+		if status != "" && job.Status != status {
+			continue
+		}
+		result = append(result, job)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logJobOpError(r, "list", "", err)
+		return
+	}
+	logJobOp(r, "list", "")
+}
+
+func JobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.PathValue("id")
+	job, err := jobs.Default().Get(id)
+	if err != nil {
+		logJobOpError(r, "get", id, err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		logJobOpError(r, "get", id, err)
+		return
+	}
+	logJobOp(r, "get", id)
+}
+
+func CancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.PathValue("id")
+	job, err := jobs.Default().Cancel(id)
+	if err != nil {
+		logJobOpError(r, "cancel", id, err)
+		if errors.Is(err, jobs.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		logJobOpError(r, "cancel", id, err)
+		return
+	}
+	logJobOp(r, "cancel", id)
+}
@@ -0,0 +1,18 @@
+package jobs
+
+import (
+	"log"
+	"net/http"
+)
+
+func logJobOp(r *http.Request, action, id string) {
+	log.Printf("jobs %s %s action=%s job=%q from=%s", r.Method, r.URL.Path, action, id, r.RemoteAddr)
+}
+
+func logJobOpError(r *http.Request, action, id string, err error) {
+	if err == nil {
+		log.Printf("jobs %s %s action=%s job=%q from=%s err=unknown", r.Method, r.URL.Path, action, id, r.RemoteAddr)
+		return
+	}
+	log.Printf("jobs %s %s action=%s job=%q from=%s err=%v", r.Method, r.URL.Path, action, id, r.RemoteAddr, err)
+}
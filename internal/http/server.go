@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"vestri-worker/internal/http/fs"
+	"vestri-worker/internal/http/jobs"
 	"vestri-worker/internal/http/stack"
 )
 
@@ -23,6 +24,27 @@ func router() http.Handler {
 	mux.HandleFunc("/stack/down", stack.StackDownHandler)
 	mux.HandleFunc("/stack/restart", stack.StackRestartHandler)
 	mux.HandleFunc("/stack/status", stack.StackStatusHandler)
+	mux.HandleFunc("/stack/logs", stack.StackLogsHandler)
+	mux.HandleFunc("/stack/list", stack.StackListHandler)
+	mux.HandleFunc("/stack/delete", stack.StackDeleteHandler)
+	mux.HandleFunc("/stack/pull", stack.StackPullHandler)
+	mux.HandleFunc("/stack/update", stack.StackUpdateHandler)
+	mux.HandleFunc("/stack/validate", stack.StackValidateHandler)
+	mux.HandleFunc("/stack/env", stack.StackEnvHandler)
+	mux.HandleFunc("/stack/stats", stack.StackStatsHandler)
+	mux.HandleFunc("/stack/exec", stack.StackExecHandler)
+	mux.HandleFunc("/stack/console", stack.StackConsoleHandler)
+	mux.HandleFunc("/stack/rcon", stack.StackRconHandler)
+	mux.HandleFunc("/stack/query", stack.StackQueryHandler)
+	mux.HandleFunc("/stack/templates", stack.StackTemplatesHandler)
+	mux.HandleFunc("/stack/create", stack.StackCreateHandler)
+	mux.HandleFunc("/stack/ports", stack.StackPortsHandler)
+	mux.HandleFunc("/stack/resources", stack.StackResourcesHandler)
+	mux.HandleFunc("/stack/meta", stack.StackMetaHandler)
+	mux.HandleFunc("/ports", stack.PortsHandler)
+	mux.HandleFunc("/jobs", jobs.ListJobsHandler)
+	mux.HandleFunc("/jobs/{id}", jobs.JobHandler)
+	mux.HandleFunc("/jobs/{id}/cancel", jobs.CancelJobHandler)
 	return withMiddlewares(mux)
 }
 
@@ -1,32 +1,119 @@
 package stack
 
 import (
-	"bytes"
-	"context"
-	"os/exec"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
 	"path/filepath"
 	"time"
+
+	"vestri-worker/internal/backend"
+	"vestri-worker/internal/http/fs"
 )
 
 const composeTimeout = 5 * time.Minute
 
-func RunCompose(stackDir string, args ...string) (string, error) {
-	stackDir, err := filepath.Abs(stackDir)
+var errNoComposeFile = errors.New("no compose file found")
+
+var composeFileNames = []string{
+	"compose.yaml",
+	"compose.yml",
+	"docker-compose.yaml",
+	"docker-compose.yml",
+}
+
+var composeOverrideNames = []string{
+	"compose.override.yml",
+	"compose.override.yaml",
+	"docker-compose.override.yml",
+	"docker-compose.override.yaml",
+}
+
+func openStack(stackPath string) (backend.Backend, backend.Project, error) {
+	project, err := stackProject(stackPath)
+	if err != nil {
+		return nil, project, err
+	}
+	rt, err := backend.Default()
+	if err != nil {
+		return nil, project, err
+	}
+	return rt, project, nil
+}
+
+func stackProject(stackPath string) (backend.Project, error) {
+	stackPath, err := filepath.Abs(stackPath)
+	if err != nil {
+		return backend.Project{}, err
+	}
+
+	project := backend.Project{
+		Name: filepath.Base(stackPath),
+		Dir:  stackPath,
+	}
+	files, err := composeFiles(stackPath)
 	if err != nil {
-		return "", err
+		return project, err
+	}
+	project.Files = files
+	return project, nil
+}
+
+func openStackStatus(err error) int {
+	if errors.Is(err, errNoComposeFile) {
+		return http.StatusNotFound
 	}
+	return http.StatusInternalServerError
+}
 
-	composeFile := filepath.Join(stackDir, "docker-compose.yml")
+func composeFiles(stackDir string) ([]string, error) {
+	meta, err := loadStackMeta(stackDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stack metadata: %w", err)
+	}
 
-	cmdArgs := append([]string{"compose", "-f", composeFile}, args...)
-	ctx, cancel := context.WithTimeout(context.Background(), composeTimeout)
-	defer cancel()
-	cmd := exec.CommandContext(ctx, "docker", cmdArgs...)
+	if len(meta.ComposeFiles) > 0 {
+		files := make([]string, 0, len(meta.ComposeFiles))
+		for _, name := range meta.ComposeFiles {
+			file, err := fs.SafePath(stackDir, name)
+			if err != nil || file == stackDir {
+				return nil, fmt.Errorf("invalid compose file %q", name)
+			}
+			if !isRegularFile(file) {
+				return nil, fmt.Errorf("compose file %q not found", name)
+			}
+			files = append(files, file)
+		}
+		return files, nil
+	}
 
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
+	var files []string
+	for _, name := range composeFileNames {
+		if file := filepath.Join(stackDir, name); isRegularFile(file) {
+			files = append(files, file)
+			break
+		}
+	}
+	if len(files) == 0 {
+		return nil, errNoComposeFile
+	}
+
+	for _, name := range composeOverrideNames {
+		if file := filepath.Join(stackDir, name); isRegularFile(file) {
+			files = append(files, file)
+			break
+		}
+	}
+	return files, nil
+}
+
+func hasComposeFile(stackDir string) bool {
+	_, err := composeFiles(stackDir)
+	return err == nil
+}
 
-	err = cmd.Run()
-	return out.String(), err
+func isRegularFile(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode().IsRegular()
 }
@@ -0,0 +1,45 @@
+package stack
+
+import (
+	"context"
+	"encoding/json"
+
+	"vestri-worker/internal/backend"
+)
+
+type composeConfig struct {
+	Name     string                    `json:"name"`
+	Services map[string]composeService `json:"services"`
+}
+
+type composeService struct {
+	Image       string        `json:"image"`
+	CPUs        composeNumber `json:"cpus"`
+	MemLimit    composeNumber `json:"mem_limit"`
+	PidsLimit   composeNumber `json:"pids_limit"`
+	BlkioConfig struct {
+		Weight composeNumber `json:"weight"`
+	} `json:"blkio_config"`
+	Deploy struct {
+		Resources struct {
+			Limits struct {
+				CPUs   composeNumber `json:"cpus"`
+				Memory composeNumber `json:"memory"`
+				Pids   composeNumber `json:"pids"`
+			} `json:"limits"`
+		} `json:"resources"`
+	} `json:"deploy"`
+}
+
+func loadComposeConfig(ctx context.Context, rt backend.Backend, project backend.Project) (composeConfig, error) {
+	var config composeConfig
+
+	out, _, err := rt.Config(ctx, project)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(out, &config); err != nil {
+		return config, err
+	}
+	return config, nil
+}
@@ -0,0 +1,482 @@
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"vestri-worker/internal/backend"
+	"vestri-worker/internal/websocket"
+)
+
+const (
+	consoleBacklogSize  = 64 << 10
+	consoleReadSize     = 32 << 10
+	consoleSendQueue    = 256
+	consoleAttachTime   = 30 * time.Second
+	consolePingInterval = 30 * time.Second
+	consoleMaxInput     = 64 << 10
+)
+
+var consoles = consoleHub{
+	sessions: make(map[string]*consoleSession),
+	pending:  make(map[string]*consoleAttach),
+}
+
+// consoleHub shares one runtime attach per stack service between all
+// WebSocket viewers of that console.
+type consoleHub struct {
+	mu       sync.Mutex
+	sessions map[string]*consoleSession
+	pending  map[string]*consoleAttach
+}
+
+// consoleAttach is an attach in progress; viewers of the same console wait
+// for it instead of attaching again.
+type consoleAttach struct {
+	done chan struct{}
+	err  error
+}
+
+type consoleSession struct {
+	hub       *consoleHub
+	key       string
+	console   backend.Console
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	refs    int
+	viewers map[*consoleViewer]struct{}
+	writer  *consoleViewer
+	backlog []byte
+	serial  int
+	closed  bool
+}
+
+type consoleViewer struct {
+	id   string
+	conn *websocket.Conn
+	send chan consoleFrame
+	done chan struct{}
+	once sync.Once
+}
+
+type consoleFrame struct {
+	opcode int
+	data   []byte
+}
+
+type consoleMessage struct {
+	Type     string `json:"type"`
+	Viewer   string `json:"viewer,omitempty"`
+	Stack    string `json:"stack,omitempty"`
+	Service  string `json:"service,omitempty"`
+	Tty      bool   `json:"tty,omitempty"`
+	Writable bool   `json:"writable,omitempty"`
+	Writer   string `json:"writer,omitempty"`
+	Data     string `json:"data,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+func StackConsoleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req stackRequest
+	stackPath, err := parseExistingStack(r, &req)
+	if err != nil {
+		logStackOpError(r, "console", "", err)
+		http.Error(w, err.Error(), stackErrorStatus(err))
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	query := r.URL.Query()
+	service := query.Get("service")
+	if !validService.MatchString(service) {
+		logStackOpError(r, "console", stackName, fmt.Errorf("invalid service name"))
+		http.Error(w, "invalid service name", http.StatusBadRequest)
+		return
+	}
+	var wantWrite bool
+	switch query.Get("mode") {
+	case "", "read":
+	case "write":
+		wantWrite = true
+	default:
+		http.Error(w, "invalid mode", http.StatusBadRequest)
+		return
+	}
+	if !websocket.IsUpgrade(r) {
+		http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+		return
+	}
+
+	rt, project, err := openStack(stackPath)
+	if err != nil {
+		logStackOpError(r, "console", stackName, err)
+		http.Error(w, err.Error(), openStackStatus(err))
+		return
+	}
+
+	session, err := consoles.acquire(r.Context(), stackName+"/"+service, func() (backend.Console, error) {
+		ctx, cancel := context.WithTimeout(r.Context(), consoleAttachTime)
+		defer cancel()
+		return rt.Attach(ctx, project, service)
+	})
+	if err != nil {
+		logStackOpError(r, "console", stackName, err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, backend.ErrServiceNotRunning) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	defer session.release()
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		logStackOpError(r, "console", stackName, err)
+		return
+	}
+	conn.MaxMessageSize = consoleMaxInput
+	logStackOp(r, "console", stackName)
+
+	viewer := session.join(conn, wantWrite, consoleMessage{
+		Type:     "hello",
+		Stack:    stackName,
+		Service:  service,
+		Tty:      session.console.Tty(),
+		Writable: session.console.Writable(),
+	})
+	defer session.leave(viewer)
+
+	go viewer.writeLoop()
+	session.readLoop(viewer)
+}
+
+// acquire returns the session for key, attaching when there is none. The
+// attach runs without the hub lock so a slow one only delays viewers of the
+// same console.
+func (h *consoleHub) acquire(ctx context.Context, key string, attach func() (backend.Console, error)) (*consoleSession, error) {
+	for {
+		h.mu.Lock()
+		if session, ok := h.sessions[key]; ok && session.addRef() {
+			h.mu.Unlock()
+			return session, nil
+		}
+		if pending, ok := h.pending[key]; ok {
+			h.mu.Unlock()
+			select {
+			case <-pending.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if pending.err != nil {
+				return nil, pending.err
+			}
+			continue
+		}
+		pending := &consoleAttach{done: make(chan struct{})}
+		h.pending[key] = pending
+		h.mu.Unlock()
+
+		console, err := attach()
+
+		h.mu.Lock()
+		delete(h.pending, key)
+		var session *consoleSession
+		if err == nil {
+			session = &consoleSession{
+				hub:     h,
+				key:     key,
+				console: console,
+				refs:    1,
+				viewers: make(map[*consoleViewer]struct{}),
+			}
+			h.sessions[key] = session
+		}
+		pending.err = err
+		close(pending.done)
+		h.mu.Unlock()
+
+		if err != nil {
+			return nil, err
+		}
+		go session.pump()
+		return session, nil
+	}
+}
+
+func (h *consoleHub) remove(session *consoleSession) {
+	h.mu.Lock()
+	if h.sessions[session.key] == session {
+		delete(h.sessions, session.key)
+	}
+	h.mu.Unlock()
+}
+
+// pump copies console output into the backlog and out to every viewer until
+// the attach ends.
+func (s *consoleSession) pump() {
+	buf := make([]byte, consoleReadSize)
+	for {
+		n, err := s.console.Read(buf)
+		if n > 0 {
+			data := append([]byte(nil), buf[:n]...)
+			s.mu.Lock()
+			s.backlog = append(s.backlog, data...)
+			if over := len(s.backlog) - consoleBacklogSize; over > 0 {
+				s.backlog = append([]byte(nil), s.backlog[over:]...)
+			}
+			for viewer := range s.viewers {
+				viewer.queue(consoleFrame{opcode: websocket.OpBinary, data: data})
+			}
+			s.mu.Unlock()
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	s.closed = true
+	exit, _ := json.Marshal(consoleMessage{Type: "exit"})
+	for viewer := range s.viewers {
+		viewer.queue(consoleFrame{opcode: websocket.OpText, data: exit})
+		viewer.finish()
+	}
+	s.mu.Unlock()
+
+	s.hub.remove(s)
+	s.closeConsole()
+}
+
+func (s *consoleSession) addRef() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.refs++
+	return true
+}
+
+func (s *consoleSession) closeConsole() {
+	s.closeOnce.Do(func() { s.console.Close() })
+}
+
+func (s *consoleSession) release() {
+	s.mu.Lock()
+	s.refs--
+	last := s.refs == 0
+	if last {
+		s.closed = true
+	}
+	s.mu.Unlock()
+
+	if last {
+		s.hub.remove(s)
+		s.closeConsole()
+	}
+}
+
+// join registers a viewer and queues the hello message and output backlog
+// for it before any live output.
+func (s *consoleSession) join(conn *websocket.Conn, wantWrite bool, hello consoleMessage) *consoleViewer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.serial++
+	viewer := &consoleViewer{
+		id:   strconv.Itoa(s.serial),
+		conn: conn,
+		send: make(chan consoleFrame, consoleSendQueue),
+		done: make(chan struct{}),
+	}
+	s.viewers[viewer] = struct{}{}
+	if s.closed {
+		viewer.finish()
+	}
+	if wantWrite && s.writer == nil && s.console.Writable() {
+		s.writer = viewer
+		s.broadcastWriterLocked(viewer)
+	}
+
+	hello.Viewer = viewer.id
+	if s.writer != nil {
+		hello.Writer = s.writer.id
+	}
+	if data, err := json.Marshal(hello); err == nil {
+		viewer.queue(consoleFrame{opcode: websocket.OpText, data: data})
+	}
+	if len(s.backlog) > 0 {
+		viewer.queue(consoleFrame{opcode: websocket.OpBinary, data: append([]byte(nil), s.backlog...)})
+	}
+	return viewer
+}
+
+func (s *consoleSession) leave(viewer *consoleViewer) {
+	s.mu.Lock()
+	delete(s.viewers, viewer)
+	if s.writer == viewer {
+		s.writer = nil
+		s.broadcastWriterLocked(nil)
+	}
+	s.mu.Unlock()
+
+	viewer.finish()
+	viewer.conn.Close(websocket.CloseNormal, "")
+}
+
+func (s *consoleSession) sendTo(viewer *consoleViewer, msg consoleMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	viewer.queue(consoleFrame{opcode: websocket.OpText, data: data})
+}
+
+func (s *consoleSession) broadcastWriterLocked(except *consoleViewer) {
+	msg := consoleMessage{Type: "writer"}
+	if s.writer != nil {
+		msg.Writer = s.writer.id
+	}
+	data, _ := json.Marshal(msg)
+	for viewer := range s.viewers {
+		if viewer != except {
+			viewer.queue(consoleFrame{opcode: websocket.OpText, data: data})
+		}
+	}
+}
+
+// readLoop handles client messages: binary frames and "input" messages are
+// written to the console by the current writer, "claim" and "release" move
+// write access between viewers.
+func (s *consoleSession) readLoop(viewer *consoleViewer) {
+	for {
+		opcode, data, err := viewer.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		if opcode == websocket.OpBinary {
+			s.input(viewer, data)
+			continue
+		}
+
+		var msg consoleMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.sendTo(viewer, consoleMessage{Type: "error", Message: "invalid message"})
+			continue
+		}
+		switch msg.Type {
+		case "input":
+			s.input(viewer, []byte(msg.Data))
+		case "claim":
+			s.claim(viewer)
+		case "release":
+			s.mu.Lock()
+			if s.writer == viewer {
+				s.writer = nil
+				s.broadcastWriterLocked(nil)
+			}
+			s.mu.Unlock()
+		default:
+			s.sendTo(viewer, consoleMessage{Type: "error", Message: "unknown message type"})
+		}
+	}
+}
+
+func (s *consoleSession) claim(viewer *consoleViewer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case !s.console.Writable():
+		s.errorLocked(viewer, "console stdin is not open")
+	case s.writer != nil && s.writer != viewer:
+		s.errorLocked(viewer, "console is held by viewer "+s.writer.id)
+	case s.writer == nil:
+		s.writer = viewer
+		s.broadcastWriterLocked(nil)
+	}
+}
+
+func (s *consoleSession) errorLocked(viewer *consoleViewer, message string) {
+	data, _ := json.Marshal(consoleMessage{Type: "error", Message: message})
+	viewer.queue(consoleFrame{opcode: websocket.OpText, data: data})
+}
+
+func (s *consoleSession) input(viewer *consoleViewer, data []byte) {
+	s.mu.Lock()
+	isWriter := s.writer == viewer
+	s.mu.Unlock()
+
+	if !isWriter {
+		s.sendTo(viewer, consoleMessage{Type: "error", Message: "write access not held"})
+		return
+	}
+	if _, err := s.console.Write(data); err != nil {
+		s.sendTo(viewer, consoleMessage{Type: "error", Message: err.Error()})
+	}
+}
+
+// queue hands a frame to the viewer's writer; a viewer that cannot keep up is
+// disconnected rather than stalling the console for everyone else.
+func (v *consoleViewer) queue(frame consoleFrame) {
+	select {
+	case <-v.done:
+	case v.send <- frame:
+	default:
+		v.finish()
+	}
+}
+
+func (v *consoleViewer) finish() {
+	v.once.Do(func() { close(v.done) })
+}
+
+func (v *consoleViewer) writeLoop() {
+	ticker := time.NewTicker(consolePingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case frame := <-v.send:
+			if err := v.conn.WriteMessage(frame.opcode, frame.data); err != nil {
+				v.finish()
+				v.conn.Close(websocket.CloseGoingAway, "")
+				return
+			}
+		case <-ticker.C:
+			if err := v.conn.Ping(nil); err != nil {
+				v.finish()
+				v.conn.Close(websocket.CloseGoingAway, "")
+				return
+			}
+		case <-v.done:
+			for {
+				select {
+				case frame := <-v.send:
+					if v.conn.WriteMessage(frame.opcode, frame.data) != nil {
+						v.conn.Close(websocket.CloseGoingAway, "")
+						return
+					}
+				default:
+					v.conn.Close(websocket.CloseNormal, "")
+					return
+				}
+			}
+		}
+	}
+}
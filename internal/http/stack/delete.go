@@ -0,0 +1,140 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"vestri-worker/internal/backend"
+	"vestri-worker/internal/http/fs"
+	"vestri-worker/internal/settings"
+)
+
+type deleteRequest struct {
+	actionRequest
+	Volumes     bool   `json:"volumes"`
+	Images      string `json:"images"`
+	Archive     bool   `json:"archive"`
+	ArchivePath string `json:"archive_path"`
+	Force       bool   `json:"force"`
+}
+
+func StackDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req deleteRequest
+	stackPath, err := parseExistingStack(r, &req)
+	if err != nil {
+		logStackOpError(r, "delete", "", err)
+		http.Error(w, err.Error(), stackErrorStatus(err))
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	if req.Images != "" && req.Images != "all" && req.Images != "local" {
+		logStackOpError(r, "delete", stackName, fmt.Errorf("invalid images value %q", req.Images))
+		http.Error(w, "images must be all or local", http.StatusBadRequest)
+		return
+	}
+
+	var archivePath string
+	if req.Archive || req.ArchivePath != "" {
+		archivePath, err = deleteArchivePath(stackName, req.ArchivePath)
+		if err != nil {
+			logStackOpError(r, "delete", stackName, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	rt, project, err := openStack(stackPath)
+	composeFile := err == nil
+	if err != nil && !errors.Is(err, errNoComposeFile) {
+		logStackOpError(r, "delete", stackName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	serveStackAction(w, r, "delete", stackName, &req.actionRequest, func(ctx context.Context, out io.Writer) error {
+		if composeFile && !req.Force {
+			status, err := loadStackStatus(ctx, stackPath, stackName)
+			if err != nil {
+				return err
+			}
+			if status.State == stateRunning || status.State == statePartial {
+				return &actionError{
+					status: http.StatusConflict,
+					err:    errors.New("stack is running; stop it first or use force"),
+				}
+			}
+		}
+
+		// Archive before anything is removed, so a failed archive leaves the
+		// stack and its volumes as they were.
+		if archivePath != "" {
+			if err := os.MkdirAll(settings.Get().ArchiveDir, 0700); err != nil {
+				return fmt.Errorf("archive: %w", err)
+			}
+			if err := fs.ZipPath(stackPath, archivePath); err != nil {
+				os.Remove(archivePath)
+				return fmt.Errorf("archive: %w", err)
+			}
+			fmt.Fprintf(out, "archived %s to %s\n", stackName, archivePath)
+		}
+
+		if composeFile {
+			opts := backend.DownOptions{
+				Volumes:       req.Volumes,
+				RemoveImages:  req.Images,
+				RemoveOrphans: true,
+			}
+			if err := rt.Down(ctx, project, opts, out); err != nil {
+				return fmt.Errorf("down: %w", err)
+			}
+		}
+
+		if err := os.RemoveAll(stackPath); err != nil {
+			return fmt.Errorf("remove: %w", err)
+		}
+		rconPool.Forget(stackName)
+		for _, path := range []string{resourceOverridePath(stackName), resourcePlanPath(stackName), checkedConfigPath(stackName)} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				fmt.Fprintf(out, "remove resource plan: %v\n", err)
+			}
+		}
+		if allocator, err := portAllocator(); err != nil {
+			fmt.Fprintf(out, "release ports: %v\n", err)
+		} else if released, err := allocator.Release(stackName, nil); err != nil {
+			fmt.Fprintf(out, "release ports: %v\n", err)
+		} else if len(released) > 0 {
+			fmt.Fprintf(out, "released %d ports\n", len(released))
+		}
+		fmt.Fprintf(out, "removed %s\n", stackName)
+		return nil
+	})
+}
+
+// deleteArchivePath places the archive in ArchiveDir, outside FsBasePath, so
+// the stack's secrets cannot be read back through /fs once it is deleted.
+func deleteArchivePath(stackName, requested string) (string, error) {
+	if requested == "" {
+		requested = fmt.Sprintf("%s-%s.zip", stackName, time.Now().UTC().Format("20060102-150405"))
+	}
+
+	dir := settings.Get().ArchiveDir
+	archivePath, err := fs.SafePath(dir, requested)
+	if err != nil {
+		return "", fmt.Errorf("invalid archive path: %w", err)
+	}
+	if base, err := filepath.Abs(dir); err != nil || archivePath == base {
+		return "", fmt.Errorf("invalid archive path")
+	}
+	return archivePath, nil
+}
@@ -0,0 +1,187 @@
+package stack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const envFileName = ".env"
+
+var validEnvKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+type envLine struct {
+	raw   string
+	key   string
+	value string
+}
+
+type envFile struct {
+	lines []envLine
+}
+
+func loadEnvFile(stackPath string) (*envFile, error) {
+	data, err := os.ReadFile(filepath.Join(stackPath, envFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &envFile{}, nil
+		}
+		return nil, err
+	}
+	return parseEnvFile(string(data)), nil
+}
+
+func parseEnvFile(content string) *envFile {
+	env := &envFile{}
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.TrimSuffix(content, "\n")
+	if content == "" {
+		return env
+	}
+
+	for _, raw := range strings.Split(content, "\n") {
+		line := envLine{raw: raw}
+		trimmed := strings.TrimSpace(raw)
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			trimmed = strings.TrimPrefix(trimmed, "export ")
+			if key, value, ok := strings.Cut(trimmed, "="); ok {
+				key = strings.TrimSpace(key)
+				if validEnvKey.MatchString(key) {
+					line.key = key
+					line.value = unquoteEnvValue(strings.TrimSpace(value))
+				}
+			}
+		}
+		env.lines = append(env.lines, line)
+	}
+	return env
+}
+
+func unquoteEnvValue(value string) string {
+	if len(value) >= 2 {
+		switch {
+		case value[0] == '\'' && value[len(value)-1] == '\'':
+			return value[1 : len(value)-1]
+		case value[0] == '"' && value[len(value)-1] == '"':
+			replacer := strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`, `$$`, `$`)
+			return replacer.Replace(value[1 : len(value)-1])
+		}
+	}
+	if idx := strings.Index(value, " #"); idx >= 0 {
+		value = strings.TrimSpace(value[:idx])
+	}
+	return value
+}
+
+func quoteEnvValue(value string) string {
+	if value == "" || !strings.ContainsAny(value, " \t\n#'\"\\$`") {
+		return value
+	}
+	if !strings.ContainsAny(value, "'\n") {
+		return "'" + value + "'"
+	}
+	// Compose interpolates double-quoted values, so a literal $ is doubled.
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, `$`, `$$`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+func (e *envFile) Get(key string) (string, bool) {
+	for i := len(e.lines) - 1; i >= 0; i-- {
+		if e.lines[i].key == key {
+			return e.lines[i].value, true
+		}
+	}
+	return "", false
+}
+
+func (e *envFile) Set(key, value string) error {
+	if !validEnvKey.MatchString(key) {
+		return fmt.Errorf("invalid env key %q", key)
+	}
+
+	line := envLine{raw: key + "=" + quoteEnvValue(value), key: key, value: value}
+	found := false
+	for i := range e.lines {
+		if e.lines[i].key == key {
+			e.lines[i] = line
+			found = true
+		}
+	}
+	if !found {
+		e.lines = append(e.lines, line)
+	}
+	return nil
+}
+
+func (e *envFile) Unset(key string) bool {
+	kept := e.lines[:0]
+	removed := false
+	for _, line := range e.lines {
+		if line.key == key {
+			removed = true
+			continue
+		}
+		kept = append(kept, line)
+	}
+	e.lines = kept
+	return removed
+}
+
+func (e *envFile) Keys() []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, line := range e.lines {
+		if line.key != "" && !seen[line.key] {
+			seen[line.key] = true
+			keys = append(keys, line.key)
+		}
+	}
+	return keys
+}
+
+func (e *envFile) String() string {
+	var b strings.Builder
+	for _, line := range e.lines {
+		b.WriteString(line.raw)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func (e *envFile) Save(stackPath string) error {
+	return writeFileAtomic(filepath.Join(stackPath, envFileName), []byte(e.String()), 0600)
+}
+
+func writeFileAtomic(path string, data []byte, defaultMode os.FileMode) error {
+	mode := defaultMode
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	return writeFileMode(path, data, mode)
+}
+
+// writeFileMode replaces path atomically with data, setting mode regardless
+// of the mode of the file it replaces.
+func writeFileMode(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
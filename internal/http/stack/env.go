@@ -0,0 +1,296 @@
+package stack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+
+	"vestri-worker/internal/backend"
+	"vestri-worker/internal/jobs"
+)
+
+const maskedValue = "********"
+
+type envEntry struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Secret bool   `json:"secret,omitempty"`
+}
+
+type envPatchRequest struct {
+	stackRequest
+	Set      map[string]string `json:"set"`
+	Unset    []string          `json:"unset"`
+	Secret   []string          `json:"secret"`
+	Recreate bool              `json:"recreate"`
+}
+
+type envResponse struct {
+	Stack     string     `json:"stack"`
+	Entries   []envEntry `json:"entries"`
+	Affected  []string   `json:"affected_services,omitempty"`
+	Recreated []string   `json:"recreated_services,omitempty"`
+	Output    string     `json:"output,omitempty"`
+}
+
+func StackEnvHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		stackEnvGet(w, r)
+	case http.MethodPatch:
+		stackEnvPatch(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func stackEnvGet(w http.ResponseWriter, r *http.Request) {
+	var req stackRequest
+	stackPath, err := parseExistingStack(r, &req)
+	if err != nil {
+		logStackOpError(r, "env", "", err)
+		http.Error(w, err.Error(), stackErrorStatus(err))
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	env, err := loadEnvFile(stackPath)
+	if err != nil {
+		logStackOpError(r, "env", stackName, err)
+		http.Error(w, "cannot read env file", http.StatusInternalServerError)
+		return
+	}
+	meta, err := loadStackMeta(stackPath)
+	if err != nil {
+		logStackOpError(r, "env", stackName, err)
+		http.Error(w, "invalid stack metadata", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, envResponse{Stack: stackName, Entries: envEntries(env, meta)})
+	logStackOp(r, "env", stackName)
+}
+
+func stackEnvPatch(w http.ResponseWriter, r *http.Request) {
+	var req envPatchRequest
+	stackPath, err := parseExistingStack(r, &req)
+	if err != nil {
+		logStackOpError(r, "env patch", "", err)
+		http.Error(w, err.Error(), stackErrorStatus(err))
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	for key := range req.Set {
+		if !validEnvKey.MatchString(key) {
+			http.Error(w, fmt.Sprintf("invalid env key %q", key), http.StatusBadRequest)
+			return
+		}
+	}
+	for _, key := range append(append([]string{}, req.Unset...), req.Secret...) {
+		if !validEnvKey.MatchString(key) {
+			http.Error(w, fmt.Sprintf("invalid env key %q", key), http.StatusBadRequest)
+			return
+		}
+	}
+
+	lock, conflict := lockStack(r, stackName, "env", false)
+	if conflict != nil {
+		logStackOpError(r, "env patch", stackName, conflict)
+		writeConflict(w, conflict)
+		return
+	}
+	defer lock.release()
+
+	ctx, cancel := context.WithTimeout(r.Context(), composeTimeout)
+	defer cancel()
+
+	var rt backend.Backend
+	var project backend.Project
+	var before map[string]json.RawMessage
+	if req.Recreate {
+		rt, project, err = openStack(stackPath)
+		if err != nil {
+			logStackOpError(r, "env patch", stackName, err)
+			http.Error(w, err.Error(), openStackStatus(err))
+			return
+		}
+		if before, err = serviceConfigs(ctx, rt, project); err != nil {
+			logStackOpError(r, "env patch", stackName, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	env, err := loadEnvFile(stackPath)
+	if err != nil {
+		logStackOpError(r, "env patch", stackName, err)
+		http.Error(w, "cannot read env file", http.StatusInternalServerError)
+		return
+	}
+	meta, err := loadStackMeta(stackPath)
+	if err != nil {
+		logStackOpError(r, "env patch", stackName, err)
+		http.Error(w, "invalid stack metadata", http.StatusInternalServerError)
+		return
+	}
+
+	keys := make([]string, 0, len(req.Set))
+	for key := range req.Set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env.Set(key, req.Set[key])
+	}
+	for _, key := range req.Unset {
+		env.Unset(key)
+	}
+
+	if err := env.Save(stackPath); err != nil {
+		logStackOpError(r, "env patch", stackName, err)
+		http.Error(w, "cannot write env file", http.StatusInternalServerError)
+		return
+	}
+
+	if len(req.Secret) > 0 {
+		meta.SecretEnv = mergeKeys(meta.SecretEnv, req.Secret)
+		if err := saveStackMeta(stackPath, meta); err != nil {
+			logStackOpError(r, "env patch", stackName, err)
+			http.Error(w, "cannot write stack metadata", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	resp := envResponse{Stack: stackName, Entries: envEntries(env, meta)}
+	if req.Recreate {
+		after, err := serviceConfigs(ctx, rt, project)
+		if err != nil {
+			logStackOpError(r, "env patch", stackName, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.Affected = changedServices(before, after)
+
+		if len(resp.Affected) > 0 {
+			releaseSlot, err := jobs.Default().Acquire(ctx)
+			if err != nil {
+				logStackOpError(r, "env patch", stackName, err)
+				http.Error(w, "too many running jobs", http.StatusServiceUnavailable)
+				return
+			}
+			defer releaseSlot()
+			if project, err = withResourcePlan(ctx, rt, project); err != nil {
+				logStackOpError(r, "env patch", stackName, err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			// The new values are saved either way; a violation only keeps
+			// them from being applied.
+			if project, err = checkedProject(ctx, rt, project); err != nil {
+				logStackOpError(r, "env patch policy", stackName, err)
+				if !writePolicyError(w, stackName, err) {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+				}
+				return
+			}
+			resp.Recreated, err = recreateServices(ctx, rt, project, resp.Affected, &resp.Output)
+			if err != nil {
+				logStackOpError(r, "env patch", stackName, err)
+				writeCommandError(w, resp.Output, err)
+				return
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+	logStackOp(r, "env patch", stackName)
+}
+
+func envEntries(env *envFile, meta stackMeta) []envEntry {
+	secret := make(map[string]bool, len(meta.SecretEnv))
+	for _, key := range meta.SecretEnv {
+		secret[key] = true
+	}
+
+	keys := env.Keys()
+	entries := make([]envEntry, 0, len(keys))
+	for _, key := range keys {
+		value, _ := env.Get(key)
+		entry := envEntry{Key: key, Value: value, Secret: secret[key]}
+		if entry.Secret {
+			entry.Value = maskedValue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func mergeKeys(existing, added []string) []string {
+	seen := make(map[string]bool, len(existing))
+	for _, key := range existing {
+		seen[key] = true
+	}
+	for _, key := range added {
+		if !seen[key] {
+			seen[key] = true
+			existing = append(existing, key)
+		}
+	}
+	return existing
+}
+
+func serviceConfigs(ctx context.Context, rt backend.Backend, project backend.Project) (map[string]json.RawMessage, error) {
+	out, _, err := rt.Config(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Services map[string]json.RawMessage `json:"services"`
+	}
+	if err := json.Unmarshal(out, &config); err != nil {
+		return nil, err
+	}
+	return config.Services, nil
+}
+
+func changedServices(before, after map[string]json.RawMessage) []string {
+	var changed []string
+	for name, config := range after {
+		if !bytes.Equal(before[name], config) {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func recreateServices(ctx context.Context, rt backend.Backend, project backend.Project, services []string, output *string) ([]string, error) {
+	containers, err := rt.Containers(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool)
+	for _, c := range containers {
+		existing[c.Service] = true
+	}
+
+	var recreate []string
+	for _, service := range services {
+		if existing[service] {
+			recreate = append(recreate, service)
+		}
+	}
+	if len(recreate) == 0 {
+		return nil, nil
+	}
+
+	var out bytes.Buffer
+	err = rt.Up(ctx, project, backend.UpOptions{Services: recreate, NoDeps: true}, &out)
+	*output = out.String()
+	return recreate, err
+}
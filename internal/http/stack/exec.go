@@ -0,0 +1,224 @@
+package stack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"vestri-worker/internal/backend"
+	"vestri-worker/internal/settings"
+)
+
+const (
+	maxExecOutput = 1 << 20
+	maxExecStdin  = 1 << 20
+)
+
+var (
+	errCommandNotAllowed = errors.New("command not allowed")
+	errExecNotAllowed    = errors.New("not allowed")
+)
+
+type execRequest struct {
+	stackRequest
+	Service string            `json:"service"`
+	Command []string          `json:"command"`
+	Stdin   string            `json:"stdin"`
+	User    string            `json:"user"`
+	Workdir string            `json:"workdir"`
+	Env     map[string]string `json:"env"`
+	Timeout int               `json:"timeout"`
+}
+
+type execResult struct {
+	Stack      string   `json:"stack"`
+	Service    string   `json:"service"`
+	Command    []string `json:"command"`
+	ExitCode   int      `json:"exit_code"`
+	Stdout     string   `json:"stdout"`
+	Stderr     string   `json:"stderr"`
+	Truncated  bool     `json:"truncated,omitempty"`
+	TimedOut   bool     `json:"timed_out,omitempty"`
+	DurationMS int64    `json:"duration_ms"`
+}
+
+// limitedBuffer keeps the first max bytes written to it and discards the rest.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func StackExecHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxExecStdin+64<<10)
+
+	var req execRequest
+	stackPath, err := parseStackName(r, &req)
+	if err != nil {
+		logStackOpError(r, "exec", "", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	opts, timeout, err := parseExecRequest(&req)
+	if err != nil {
+		logStackOpError(r, "exec", stackName, err)
+		status := http.StatusBadRequest
+		if errors.Is(err, errCommandNotAllowed) || errors.Is(err, errExecNotAllowed) {
+			status = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	rt, project, err := openStack(stackPath)
+	if err != nil {
+		logStackOpError(r, "exec", stackName, err)
+		http.Error(w, err.Error(), openStackStatus(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	stdout := &limitedBuffer{max: maxExecOutput}
+	stderr := &limitedBuffer{max: maxExecOutput}
+	started := time.Now()
+	code, err := rt.Exec(ctx, project, opts, stdout, stderr)
+	result := execResult{
+		Stack:      stackName,
+		Service:    req.Service,
+		Command:    req.Command,
+		ExitCode:   code,
+		Stdout:     stdout.buf.String(),
+		Stderr:     stderr.buf.String(),
+		Truncated:  stdout.truncated || stderr.truncated,
+		TimedOut:   errors.Is(ctx.Err(), context.DeadlineExceeded),
+		DurationMS: time.Since(started).Milliseconds(),
+	}
+	if err != nil && !result.TimedOut {
+		logStackOpError(r, "exec", stackName, err)
+		writeCommandError(w, result.Stderr, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+	logStackOp(r, "exec", stackName)
+}
+
+func parseExecRequest(req *execRequest) (backend.ExecOptions, time.Duration, error) {
+	var opts backend.ExecOptions
+
+	if !validService.MatchString(req.Service) {
+		return opts, 0, fmt.Errorf("invalid service name")
+	}
+	if len(req.Command) == 0 || strings.TrimSpace(req.Command[0]) == "" {
+		return opts, 0, fmt.Errorf("command is required")
+	}
+	if len(req.Stdin) > maxExecStdin {
+		return opts, 0, fmt.Errorf("stdin too large")
+	}
+
+	// The user, working directory and environment can turn an allowed
+	// command into a different one, so they have allowlists of their own.
+	cfg := settings.Get()
+	if !commandAllowed(req.Command, cfg.ExecAllowedCommands) {
+		return opts, 0, errCommandNotAllowed
+	}
+	if req.User != "" && !slices.Contains(cfg.ExecAllowedUsers, req.User) {
+		return opts, 0, fmt.Errorf("user %q: %w", req.User, errExecNotAllowed)
+	}
+	if req.Workdir != "" {
+		req.Workdir = path.Clean(req.Workdir)
+		if !slices.Contains(cfg.ExecAllowedWorkdirs, req.Workdir) {
+			return opts, 0, fmt.Errorf("workdir %q: %w", req.Workdir, errExecNotAllowed)
+		}
+	}
+
+	timeout := time.Duration(cfg.ExecTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = composeTimeout
+	}
+	if req.Timeout < 0 {
+		return opts, 0, fmt.Errorf("invalid timeout")
+	}
+	if req.Timeout > 0 {
+		if requested := time.Duration(req.Timeout) * time.Second; requested < timeout {
+			timeout = requested
+		}
+	}
+
+	opts = backend.ExecOptions{
+		Service: req.Service,
+		Command: req.Command,
+		User:    req.User,
+		Workdir: req.Workdir,
+	}
+	if req.Stdin != "" {
+		opts.Stdin = strings.NewReader(req.Stdin)
+	}
+	for key, value := range req.Env {
+		if !validEnvKey.MatchString(key) {
+			return opts, 0, fmt.Errorf("invalid env key %q", key)
+		}
+		if !slices.Contains(cfg.ExecAllowedEnv, key) {
+			return opts, 0, fmt.Errorf("env key %q: %w", key, errExecNotAllowed)
+		}
+		opts.Env = append(opts.Env, key+"="+value)
+	}
+	sort.Strings(opts.Env)
+	return opts, timeout, nil
+}
+
+// commandAllowed reports whether command starts with the words of one of the
+// allowlist entries. An entry of "*" allows any command.
+func commandAllowed(command []string, allowed []string) bool {
+	for _, entry := range allowed {
+		words := strings.Fields(entry)
+		if len(words) == 0 {
+			continue
+		}
+		if len(words) == 1 && words[0] == "*" {
+			return true
+		}
+		if len(words) > len(command) {
+			continue
+		}
+		match := true
+		for i, word := range words {
+			if command[i] != word {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
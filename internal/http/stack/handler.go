@@ -1,48 +1,336 @@
 package stack
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
+	"time"
 
+	"vestri-worker/internal/backend"
 	"vestri-worker/internal/http/fs"
+	"vestri-worker/internal/jobs"
 	"vestri-worker/internal/settings"
 )
 
 var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 
-func parseStackName(r *http.Request) (string, error) {
-	type Req struct {
-		Stack string `json:"stack"`
+type stackRequest struct {
+	Stack string `json:"stack"`
+}
+
+func (req *stackRequest) base() *stackRequest {
+	return req
+}
+
+type stackRequester interface {
+	base() *stackRequest
+}
+
+type actionRequest struct {
+	stackRequest
+	Async  bool   `json:"async"`
+	Stream string `json:"stream"`
+	Wait   bool   `json:"wait"`
+
+	// timeout bounds the whole action when it runs more than one compose
+	// command; composeTimeout applies otherwise.
+	timeout time.Duration
+}
+
+func (req *actionRequest) runTimeout() time.Duration {
+	if req.timeout > 0 {
+		return req.timeout
+	}
+	return composeTimeout
+}
+
+// servicesRequest limits an action to some of the stack's services.
+type servicesRequest struct {
+	Services []string `json:"services"`
+}
+
+func (req *servicesRequest) normalize() error {
+	services, err := parseServices(req.Services)
+	if err != nil {
+		return err
+	}
+	req.Services = services
+	return nil
+}
+
+type stackRunFunc func(ctx context.Context, out io.Writer) error
+
+type stackResultFunc func(ctx context.Context, out io.Writer) (any, error)
+
+type actionResult struct {
+	Output string `json:"output"`
+	Result any    `json:"result,omitempty"`
+}
+
+var errStackNotFound = errors.New("stack not found")
+
+// actionError is a failure an action detects itself, as opposed to a failing
+// compose command, and is answered with its own status.
+type actionError struct {
+	status int
+	err    error
+}
+
+func (e *actionError) Error() string {
+	return e.err.Error()
+}
+
+func (e *actionError) Unwrap() error {
+	return e.err
+}
+
+func parseStackName(r *http.Request, req stackRequester) (string, error) {
+	stackPath, err := resolveStackName(r, req)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(stackPath, 0755); err != nil {
+		return "", fmt.Errorf("failed to create stack directory: %w", err)
+	}
+
+	return stackPath, nil
+}
+
+func parseExistingStack(r *http.Request, req stackRequester) (string, error) {
+	stackPath, err := resolveStackName(r, req)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Lstat(stackPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", errStackNotFound
+		}
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", errStackNotFound
 	}
-	var req Req
+
+	return stackPath, nil
+}
+
+func resolveStackName(r *http.Request, req stackRequester) (string, error) {
+	base := req.base()
 
 	if r.Method == http.MethodGet {
-		req.Stack = r.URL.Query().Get("stack")
+		base.Stack = r.URL.Query().Get("stack")
 	} else {
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
 			return "", fmt.Errorf("bad request: %w", err)
 		}
 	}
 
-	if req.Stack == "" || !validName.MatchString(req.Stack) {
+	if base.Stack == "" || !validName.MatchString(base.Stack) {
 		return "", fmt.Errorf("invalid stack name")
 	}
 
 	settings := settings.Get()
-	stackPath, err := fs.SafeSubPath(settings.FsBasePath, req.Stack)
+	stackPath, err := fs.SafeSubPath(settings.FsBasePath, base.Stack)
 	if err != nil {
 		return "", fmt.Errorf("invalid stack path: %w", err)
 	}
 
-	if err := os.MkdirAll(stackPath, 0755); err != nil {
-		return "", fmt.Errorf("failed to create stack directory: %w", err)
+	return stackPath, nil
+}
+
+func stackErrorStatus(err error) int {
+	if errors.Is(err, errStackNotFound) {
+		return http.StatusNotFound
 	}
+	return http.StatusBadRequest
+}
 
-	return stackPath, nil
+func serveStackAction(w http.ResponseWriter, r *http.Request, action, stackName string, req *actionRequest, run stackRunFunc) {
+	serveStackResult(w, r, action, stackName, req, func(ctx context.Context, out io.Writer) (any, error) {
+		return nil, run(ctx, out)
+	})
+}
+
+func serveStackResult(w http.ResponseWriter, r *http.Request, action, stackName string, req *actionRequest, run stackResultFunc) {
+	mode, err := streamMode(r, req.Stream)
+	if err != nil {
+		logStackOpError(r, action, stackName, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Async && mode != "" {
+		logStackOpError(r, action, stackName, fmt.Errorf("async and stream requested"))
+		http.Error(w, "async and stream cannot be combined", http.StatusBadRequest)
+		return
+	}
+
+	if req.Async {
+		var lock *stackLock
+		if !req.Wait {
+			var conflict *conflictError
+			if lock, conflict = stackLocks.tryAcquire(stackName, action); conflict != nil {
+				logStackOpError(r, action, stackName, conflict)
+				writeConflict(w, conflict)
+				return
+			}
+		}
+
+		// A waiting job queues for the stack lock before it takes a worker
+		// slot, the same order as synchronous actions.
+		var wait jobs.WaitFunc
+		if lock == nil {
+			wait = func(ctx context.Context) (func(), error) {
+				acquired, conflict := stackLocks.acquire(ctx, stackName, action)
+				if conflict != nil {
+					return nil, conflict
+				}
+				return acquired.release, nil
+			}
+		}
+
+		job, err := jobs.Default().SubmitAfter(action, stackName, wait, func(ctx context.Context, out io.Writer) (any, error) {
+			ctx, cancel := context.WithTimeout(ctx, req.runTimeout())
+			defer cancel()
+			return run(ctx, out)
+		})
+		if err != nil {
+			if lock != nil {
+				lock.release()
+			}
+			logStackOpError(r, action, stackName, err)
+			http.Error(w, "cannot create job", http.StatusInternalServerError)
+			return
+		}
+		if lock != nil {
+			lock.setJob(job.ID)
+			releaseWhenDone(lock, job.ID)
+		}
+
+		writeJSON(w, http.StatusAccepted, job)
+		logStackJob(r, action, stackName, job.ID)
+		return
+	}
+
+	lock, conflict := lockStack(r, stackName, action, req.Wait)
+	if conflict != nil {
+		logStackOpError(r, action, stackName, conflict)
+		writeConflict(w, conflict)
+		return
+	}
+	defer lock.release()
+
+	slotCtx, slotCancel := context.WithTimeout(r.Context(), composeTimeout)
+	releaseSlot, err := jobs.Default().Acquire(slotCtx)
+	slotCancel()
+	if err != nil {
+		logStackOpError(r, action, stackName, err)
+		http.Error(w, "too many running jobs", http.StatusServiceUnavailable)
+		return
+	}
+	defer releaseSlot()
+
+	ctx, cancel := context.WithTimeout(context.Background(), req.runTimeout())
+	defer cancel()
+
+	if mode != "" {
+		stream, err := newStreamWriter(w, mode)
+		if err != nil {
+			logStackOpError(r, action, stackName, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		result, err := run(ctx, stream)
+		if result != nil {
+			stream.Result(result)
+		}
+		stream.Close(err)
+		if streamErr := stream.Err(); streamErr != nil {
+			logStackOpError(r, action+" stream", stackName, streamErr)
+		}
+		if err != nil {
+			logStackOpError(r, action, stackName, err)
+			return
+		}
+		logStackOp(r, action, stackName)
+		return
+	}
+
+	var out bytes.Buffer
+	result, err := run(ctx, &out)
+	if err != nil {
+		logStackOpError(r, action, stackName, err)
+		var actionErr *actionError
+		if errors.As(err, &actionErr) {
+			http.Error(w, actionErr.Error(), actionErr.status)
+			return
+		}
+		if writePolicyError(w, stackName, err) {
+			return
+		}
+		writeCommandError(w, out.String(), err)
+		return
+	}
+
+	if result != nil {
+		writeJSON(w, http.StatusOK, actionResult{Output: out.String(), Result: result})
+	} else {
+		w.WriteHeader(http.StatusOK)
+		w.Write(out.Bytes())
+	}
+	logStackOp(r, action, stackName)
+}
+
+func lockStack(r *http.Request, stackName, action string, wait bool) (*stackLock, *conflictError) {
+	if !wait {
+		return stackLocks.tryAcquire(stackName, action)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), composeTimeout)
+	defer cancel()
+
+	return stackLocks.acquire(ctx, stackName, action)
+}
+
+func releaseWhenDone(lock *stackLock, jobID string) {
+	done, err := jobs.Default().Done(jobID)
+	if err != nil {
+		lock.release()
+		return
+	}
+	go func() {
+		<-done
+		lock.release()
+	}()
+}
+
+func writeCommandError(w http.ResponseWriter, out string, err error) {
+	if strings.TrimSpace(out) == "" {
+		out = err.Error()
+	}
+	http.Error(w, out, http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+type upRequest struct {
+	actionRequest
+	servicesRequest
+	Validate bool `json:"validate"`
 }
 
 func StackUpHandler(w http.ResponseWriter, r *http.Request) {
@@ -51,7 +339,8 @@ func StackUpHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stackPath, err := parseStackName(r)
+	var req upRequest
+	stackPath, err := parseStackName(r, &req)
 	if err != nil {
 		logStackOpError(r, "up", "", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -59,16 +348,45 @@ func StackUpHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	stackName := filepath.Base(stackPath)
 
-	out, err := RunCompose(stackPath, "up", "-d")
+	if err := req.normalize(); err != nil {
+		logStackOpError(r, "up", stackName, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rt, project, err := openStack(stackPath)
 	if err != nil {
 		logStackOpError(r, "up", stackName, err)
-		http.Error(w, out, http.StatusInternalServerError)
+		http.Error(w, err.Error(), openStackStatus(err))
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(out))
-	logStackOp(r, "up", stackName)
+	if req.Validate {
+		ctx, cancel := context.WithTimeout(r.Context(), composeTimeout)
+		result, err := validateStack(ctx, rt, project)
+		cancel()
+		if err != nil {
+			logStackOpError(r, "up validate", stackName, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !result.Valid {
+			logStackOpError(r, "up validate", stackName, fmt.Errorf("invalid compose configuration"))
+			writeJSON(w, http.StatusUnprocessableEntity, result)
+			return
+		}
+	}
+
+	serveStackAction(w, r, "up", stackName, &req.actionRequest, func(ctx context.Context, out io.Writer) error {
+		planned, err := withResourcePlan(ctx, rt, project)
+		if err != nil {
+			return err
+		}
+		if planned, err = checkedProject(ctx, rt, planned); err != nil {
+			return err
+		}
+		return rt.Up(ctx, planned, backend.UpOptions{Services: req.Services}, out)
+	})
 }
 
 func StackDownHandler(w http.ResponseWriter, r *http.Request) {
@@ -77,7 +395,8 @@ func StackDownHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stackPath, err := parseStackName(r)
+	var req stopRequest
+	stackPath, err := parseStackName(r, &req)
 	if err != nil {
 		logStackOpError(r, "down", "", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -85,16 +404,39 @@ func StackDownHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	stackName := filepath.Base(stackPath)
 
-	out, err := RunCompose(stackPath, "down")
+	if err := req.normalize(); err != nil {
+		logStackOpError(r, "down", stackName, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rt, project, err := openStack(stackPath)
 	if err != nil {
 		logStackOpError(r, "down", stackName, err)
-		http.Error(w, out, http.StatusInternalServerError)
+		http.Error(w, err.Error(), openStackStatus(err))
 		return
 	}
+	policy, err := loadStopPolicy(stackPath, stackName)
+	if err != nil {
+		logStackOpError(r, "down", stackName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	serveStackAction(w, r, "down", stackName, &req.actionRequest, func(ctx context.Context, out io.Writer) error {
+		return policy.down(ctx, rt, project, backend.DownOptions{Services: req.Services}, req.SkipPreStop, out)
+	})
+}
+
+const (
+	restartInPlace  = "restart"
+	restartRecreate = "recreate"
+	restartFull     = "full"
+)
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(out))
-	logStackOp(r, "down", stackName)
+type restartRequest struct {
+	stopRequest
+	Mode string `json:"mode"`
 }
 
 func StackRestartHandler(w http.ResponseWriter, r *http.Request) {
@@ -103,7 +445,8 @@ func StackRestartHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stackPath, err := parseStackName(r)
+	var req restartRequest
+	stackPath, err := parseStackName(r, &req)
 	if err != nil {
 		logStackOpError(r, "restart", "", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -111,22 +454,78 @@ func StackRestartHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	stackName := filepath.Base(stackPath)
 
-	if out, err := RunCompose(stackPath, "down"); err != nil {
-		logStackOpError(r, "restart down", stackName, err)
-		http.Error(w, out, http.StatusInternalServerError)
+	if err := req.normalize(); err != nil {
+		logStackOpError(r, "restart", stackName, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = restartFull
+	}
+	if req.Mode != restartInPlace && req.Mode != restartRecreate && req.Mode != restartFull {
+		logStackOpError(r, "restart", stackName, fmt.Errorf("invalid restart mode %q", req.Mode))
+		http.Error(w, "mode must be restart, recreate or full", http.StatusBadRequest)
 		return
 	}
 
-	out, err := RunCompose(stackPath, "up", "-d")
+	rt, project, err := openStack(stackPath)
 	if err != nil {
-		logStackOpError(r, "restart up", stackName, err)
-		http.Error(w, out, http.StatusInternalServerError)
+		logStackOpError(r, "restart", stackName, err)
+		http.Error(w, err.Error(), openStackStatus(err))
 		return
 	}
+	policy, err := loadStopPolicy(stackPath, stackName)
+	if err != nil {
+		logStackOpError(r, "restart", stackName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Stopping may use most of composeTimeout on its own, so the start that
+	// follows gets a budget of its own.
+	if req.Mode != restartInPlace {
+		req.timeout = 2 * composeTimeout
+	}
+
+	serveStackAction(w, r, "restart", stackName, &req.actionRequest, func(ctx context.Context, out io.Writer) error {
+		// The plan and the policy are applied before anything stops, so a
+		// stack the policy rejects keeps running instead of being left down.
+		planned := project
+		if req.Mode != restartInPlace {
+			var err error
+			if planned, err = withResourcePlan(ctx, rt, project); err != nil {
+				return err
+			}
+			if planned, err = checkedProject(ctx, rt, planned); err != nil {
+				return err
+			}
+		}
+
+		stopCtx, cancel := context.WithTimeout(ctx, composeTimeout)
+		defer cancel()
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(out))
-	logStackOp(r, "restart", stackName)
+		switch req.Mode {
+		case restartInPlace:
+			if err := policy.beforeStop(stopCtx, rt, project, req.Services, req.SkipPreStop, out); err != nil {
+				return err
+			}
+			return rt.Restart(stopCtx, project, req.Services, policy.timeout, out)
+		case restartRecreate:
+			if err := policy.beforeStop(stopCtx, rt, project, req.Services, req.SkipPreStop, out); err != nil {
+				return err
+			}
+			opts := backend.UpOptions{Services: req.Services, ForceRecreate: true, Timeout: policy.timeout}
+			return rt.Up(ctx, planned, opts, out)
+		}
+
+		if err := policy.down(stopCtx, rt, project, backend.DownOptions{Services: req.Services}, req.SkipPreStop, out); err != nil {
+			return fmt.Errorf("down: %w", err)
+		}
+		if err := rt.Up(ctx, planned, backend.UpOptions{Services: req.Services}, out); err != nil {
+			return fmt.Errorf("up: %w", err)
+		}
+		return nil
+	})
 }
 
 func StackStatusHandler(w http.ResponseWriter, r *http.Request) {
@@ -135,7 +534,8 @@ func StackStatusHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stackPath, err := parseStackName(r)
+	var req stackRequest
+	stackPath, err := parseStackName(r, &req)
 	if err != nil {
 		logStackOpError(r, "status", "", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -143,14 +543,42 @@ func StackStatusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	stackName := filepath.Base(stackPath)
 
-	out, err := RunCompose(stackPath, "ps")
+	ctx, cancel := context.WithTimeout(r.Context(), composeTimeout)
+	defer cancel()
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+	case "text":
+		rt, project, err := openStack(stackPath)
+		if err != nil {
+			logStackOpError(r, "status", stackName, err)
+			http.Error(w, err.Error(), openStackStatus(err))
+			return
+		}
+
+		var out bytes.Buffer
+		if err := rt.Ps(ctx, project, &out); err != nil {
+			logStackOpError(r, "status", stackName, err)
+			writeCommandError(w, out.String(), err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(out.Bytes())
+		logStackOp(r, "status", stackName)
+		return
+	default:
+		http.Error(w, "invalid format", http.StatusBadRequest)
+		return
+	}
+
+	status, err := loadStackStatus(ctx, stackPath, stackName)
 	if err != nil {
 		logStackOpError(r, "status", stackName, err)
-		http.Error(w, out, http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(out))
+	writeJSON(w, http.StatusOK, status)
 	logStackOp(r, "status", stackName)
 }
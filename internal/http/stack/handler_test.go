@@ -0,0 +1,218 @@
+package stack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"vestri-worker/internal/backend"
+	"vestri-worker/internal/settings"
+)
+
+// newTestStack points the settings at temporary directories, creates a stack
+// with a compose file and registers it with a fake backend.
+func newTestStack(t *testing.T, name string, services map[string]string) (*backend.Fake, string) {
+	t.Helper()
+
+	s := settings.Default()
+	s.FsBasePath = t.TempDir()
+	s.ResourceOverrideDir = t.TempDir()
+	s.ArchiveDir = t.TempDir()
+	s.PortStateFile = filepath.Join(t.TempDir(), "ports.json")
+	previous := settings.Get()
+	settings.Set(s)
+	t.Cleanup(func() { settings.Set(previous) })
+
+	stackPath := filepath.Join(s.FsBasePath, name)
+	if err := os.Mkdir(stackPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stackPath, "compose.yaml"), []byte("services: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := backend.NewFake()
+	fake.AddProject(stackPath, services)
+	backend.SetDefault(fake)
+	t.Cleanup(func() { backend.SetDefault(nil) })
+
+	return fake, stackPath
+}
+
+func serve(handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func getStatus(t *testing.T, stack string) stackStatus {
+	t.Helper()
+
+	w := serve(StackStatusHandler, http.MethodGet, "/stack/status?stack="+stack, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: %d %s", w.Code, w.Body)
+	}
+	var status stackStatus
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	return status
+}
+
+func TestStackUpDownStatus(t *testing.T) {
+	fake, stackPath := newTestStack(t, "game", map[string]string{"app": "nginx", "db": "postgres"})
+
+	if status := getStatus(t, "game"); status.State != stateMissing || len(status.Containers) != 0 {
+		t.Fatalf("before up: state %q, %d containers", status.State, len(status.Containers))
+	}
+
+	w := serve(StackUpHandler, http.MethodPost, "/stack/up", `{"stack":"game"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("up: %d %s", w.Code, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "game-app-1 Started") {
+		t.Errorf("up output = %q", w.Body)
+	}
+
+	status := getStatus(t, "game")
+	if status.State != stateRunning || len(status.Containers) != 2 {
+		t.Fatalf("after up: state %q, %d containers", status.State, len(status.Containers))
+	}
+	for _, c := range status.Containers {
+		if c.State != "running" {
+			t.Errorf("%s state = %q", c.Service, c.State)
+		}
+	}
+
+	w = serve(StackDownHandler, http.MethodPost, "/stack/down", `{"stack":"game"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("down: %d %s", w.Code, w.Body)
+	}
+	if status := getStatus(t, "game"); len(status.Containers) != 0 {
+		t.Errorf("after down: %d containers", len(status.Containers))
+	}
+
+	calls := strings.Join(fake.Calls(), "\n")
+	for _, want := range []string{"up " + stackPath, "down " + stackPath} {
+		if !strings.Contains(calls, want) {
+			t.Errorf("calls %q missing %q", calls, want)
+		}
+	}
+}
+
+func TestStackUpServices(t *testing.T) {
+	newTestStack(t, "game", map[string]string{"app": "nginx", "db": "postgres"})
+
+	w := serve(StackUpHandler, http.MethodPost, "/stack/up", `{"stack":"game","services":["db"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("up: %d %s", w.Code, w.Body)
+	}
+
+	status := getStatus(t, "game")
+	if status.State != statePartial || len(status.Containers) != 1 || status.Containers[0].Service != "db" {
+		t.Errorf("state %q, containers %+v", status.State, status.Containers)
+	}
+}
+
+func TestStackHandlerErrors(t *testing.T) {
+	newTestStack(t, "game", map[string]string{"app": "nginx"})
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    string
+		want    int
+	}{
+		{"up method", StackUpHandler, http.MethodGet, "/stack/up", "", http.StatusMethodNotAllowed},
+		{"up invalid name", StackUpHandler, http.MethodPost, "/stack/up", `{"stack":"../etc"}`, http.StatusBadRequest},
+		{"up unknown service", StackUpHandler, http.MethodPost, "/stack/up", `{"stack":"game","services":["-x"]}`, http.StatusBadRequest},
+		{"up missing stack", StackUpHandler, http.MethodPost, "/stack/up", `{"stack":"other"}`, http.StatusNotFound},
+		{"down method", StackDownHandler, http.MethodGet, "/stack/down", "", http.StatusMethodNotAllowed},
+		{"down bad body", StackDownHandler, http.MethodPost, "/stack/down", `{`, http.StatusBadRequest},
+		{"status method", StackStatusHandler, http.MethodPost, "/stack/status", `{"stack":"game"}`, http.StatusMethodNotAllowed},
+		{"status format", StackStatusHandler, http.MethodGet, "/stack/status?stack=game&format=xml", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.handler, tt.method, tt.target, tt.body)
+			if w.Code != tt.want {
+				t.Errorf("got %d %q, want %d", w.Code, strings.TrimSpace(w.Body.String()), tt.want)
+			}
+		})
+	}
+}
+
+func TestStackDeleteArchiveFailure(t *testing.T) {
+	fake, stackPath := newTestStack(t, "game", map[string]string{"app": "nginx"})
+
+	// Symlinks cannot be archived, so the archive step fails.
+	if err := os.Symlink("/etc/hostname", filepath.Join(stackPath, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(StackDeleteHandler, http.MethodPost, "/stack/delete", `{"stack":"game","archive":true,"volumes":true}`)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+	if _, err := os.Stat(stackPath); err != nil {
+		t.Errorf("stack removed after failed archive: %v", err)
+	}
+	for _, call := range fake.Calls() {
+		if strings.HasPrefix(call, "down ") {
+			t.Errorf("down ran after failed archive: %q", call)
+		}
+	}
+}
+
+func TestStackValidateServices(t *testing.T) {
+	newTestStack(t, "game", map[string]string{"app": "nginx", "db": "postgres"})
+
+	w := serve(StackValidateHandler, http.MethodGet, "/stack/validate?stack=game", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("validate: %d %s", w.Code, w.Body)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw["config"]; ok {
+		t.Errorf("response includes the normalized config: %s", w.Body)
+	}
+	if got := string(raw["services"]); got != `["app","db"]` {
+		t.Errorf("services = %s", got)
+	}
+}
+
+func TestStackUpWritesCheckedConfig(t *testing.T) {
+	newTestStack(t, "game", map[string]string{"app": "nginx"})
+
+	if w := serve(StackUpHandler, http.MethodPost, "/stack/up", `{"stack":"game"}`); w.Code != http.StatusOK {
+		t.Fatalf("up: %d %s", w.Code, w.Body)
+	}
+
+	path := checkedConfigPath("game")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("checked config not written: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("mode = %o, want 600", mode)
+	}
+	if strings.HasPrefix(path, settings.Get().FsBasePath) {
+		t.Errorf("checked config %s is inside FsBasePath", path)
+	}
+
+	if w := serve(StackDeleteHandler, http.MethodPost, "/stack/delete", `{"stack":"game","force":true}`); w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("checked config left after delete: %v", err)
+	}
+}
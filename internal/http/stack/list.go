@@ -0,0 +1,183 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"vestri-worker/internal/backend"
+	"vestri-worker/internal/settings"
+)
+
+type stackListEntry struct {
+	Name         string            `json:"name"`
+	ComposeFile  bool              `json:"compose_file"`
+	State        string            `json:"state"`
+	DisplayName  string            `json:"display_name,omitempty"`
+	Owner        string            `json:"owner,omitempty"`
+	Game         string            `json:"game,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	DesiredState string            `json:"desired_state,omitempty"`
+	Autostart    bool              `json:"autostart,omitempty"`
+	Template     string            `json:"template,omitempty"`
+	MetaError    string            `json:"meta_error,omitempty"`
+	DiskUsage    *int64            `json:"disk_usage_bytes,omitempty"`
+	ModifiedAt   *time.Time        `json:"modified_at,omitempty"`
+}
+
+func StackListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Walking every stack tree is expensive, so disk usage is opt-in.
+	withUsage := parseBool(r.URL.Query().Get("usage"))
+	owner := r.URL.Query().Get("owner")
+	labels, err := parseLabelFilters(r.URL.Query()["label"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	base, err := filepath.Abs(settings.Get().FsBasePath)
+	if err != nil {
+		logStackOpError(r, "list", "", err)
+		http.Error(w, "invalid base path", http.StatusInternalServerError)
+		return
+	}
+
+	entries, err := os.ReadDir(base)
+	if err != nil && !os.IsNotExist(err) {
+		logStackOpError(r, "list", "", err)
+		http.Error(w, "cannot read stacks directory", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), composeTimeout)
+	defer cancel()
+
+	states, err := composeProjectStates(ctx)
+	if err != nil {
+		logStackOpError(r, "list", "", err)
+	}
+
+	result := make([]stackListEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() || !validName.MatchString(entry.Name()) {
+			continue
+		}
+		stackPath := filepath.Join(base, entry.Name())
+
+		meta, metaErr := loadStackMeta(stackPath)
+		if owner != "" && meta.Owner != owner || !matchLabels(meta.Labels, labels) {
+			continue
+		}
+
+		item := stackListEntry{
+			Name:         entry.Name(),
+			ComposeFile:  hasComposeFile(stackPath),
+			State:        stateMissing,
+			DisplayName:  meta.DisplayName,
+			Owner:        meta.Owner,
+			Game:         meta.Game,
+			Labels:       meta.Labels,
+			DesiredState: meta.DesiredState,
+			Autostart:    meta.Autostart,
+			Template:     meta.Template,
+		}
+		if metaErr != nil {
+			item.MetaError = "invalid stack metadata"
+		}
+		if state, ok := states[stackPath]; ok {
+			item.State = state
+		}
+		if withUsage {
+			if size, modified, err := dirUsage(stackPath); err == nil {
+				item.DiskUsage = &size
+				item.ModifiedAt = &modified
+			}
+		}
+		result = append(result, item)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+	logStackOp(r, "list", "")
+}
+
+func composeProjectStates(ctx context.Context) (map[string]string, error) {
+	states := make(map[string]string)
+
+	rt, err := backend.Default()
+	if err != nil {
+		return states, err
+	}
+	projects, err := rt.Projects(ctx)
+	if err != nil {
+		return states, err
+	}
+
+	for dir, containers := range projects {
+		items := make([]serviceStatus, 0, len(containers))
+		for _, c := range containers {
+			items = append(items, serviceStatus{Service: c.Service, State: c.State})
+		}
+		states[dir], _ = aggregateState(items, nil)
+	}
+	return states, nil
+}
+
+func dirUsage(dir string) (int64, time.Time, error) {
+	var size int64
+	var modified time.Time
+
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+		return nil
+	})
+	return size, modified, err
+}
+
+// parseLabelFilters reads label=key=value query parameters. A filter
+// without a value matches any stack carrying the key.
+func parseLabelFilters(values []string) (map[string]*string, error) {
+	filters := make(map[string]*string, len(values))
+	for _, value := range values {
+		key, v, ok := strings.Cut(value, "=")
+		if !validLabelKey.MatchString(key) {
+			return nil, fmt.Errorf("invalid label filter %q", value)
+		}
+		if ok {
+			filters[key] = &v
+		} else {
+			filters[key] = nil
+		}
+	}
+	return filters, nil
+}
+
+func matchLabels(labels map[string]string, filters map[string]*string) bool {
+	for key, want := range filters {
+		value, ok := labels[key]
+		if !ok || want != nil && value != *want {
+			return false
+		}
+	}
+	return true
+}
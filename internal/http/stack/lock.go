@@ -0,0 +1,122 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var stackLocks lockManager
+
+type lockHolder struct {
+	Stack     string    `json:"stack"`
+	Operation string    `json:"operation"`
+	Job       string    `json:"job,omitempty"`
+	Since     time.Time `json:"since"`
+}
+
+type lockManager struct {
+	mu   sync.Mutex
+	held map[string]*stackLock
+}
+
+type stackLock struct {
+	manager  *lockManager
+	holder   lockHolder
+	released chan struct{}
+	once     sync.Once
+}
+
+type conflictError struct {
+	holder lockHolder
+}
+
+func (e *conflictError) Error() string {
+	return fmt.Sprintf("stack %s is busy with %s", e.holder.Stack, e.holder.Operation)
+}
+
+func (m *lockManager) tryAcquire(stack, operation string) (*stackLock, *conflictError) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.held == nil {
+		m.held = make(map[string]*stackLock)
+	}
+	if lock, ok := m.held[stack]; ok {
+		return nil, &conflictError{holder: lock.holder}
+	}
+
+	lock := &stackLock{
+		manager: m,
+		holder: lockHolder{
+			Stack:     stack,
+			Operation: operation,
+			Since:     time.Now(),
+		},
+		released: make(chan struct{}),
+	}
+	m.held[stack] = lock
+	return lock, nil
+}
+
+func (m *lockManager) acquire(ctx context.Context, stack, operation string) (*stackLock, *conflictError) {
+	for {
+		lock, conflict := m.tryAcquire(stack, operation)
+		if conflict == nil {
+			return lock, nil
+		}
+
+		m.mu.Lock()
+		current := m.held[stack]
+		m.mu.Unlock()
+		if current == nil {
+			continue
+		}
+
+		select {
+		case <-current.released:
+		case <-ctx.Done():
+			return nil, conflict
+		}
+	}
+}
+
+func (m *lockManager) holder(stack string) (lockHolder, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lock, ok := m.held[stack]
+	if !ok {
+		return lockHolder{}, false
+	}
+	return lock.holder, true
+}
+
+func (l *stackLock) setJob(id string) {
+	l.manager.mu.Lock()
+	l.holder.Job = id
+	l.manager.mu.Unlock()
+}
+
+func (l *stackLock) release() {
+	l.once.Do(func() {
+		l.manager.mu.Lock()
+		if l.manager.held[l.holder.Stack] == l {
+			delete(l.manager.held, l.holder.Stack)
+		}
+		l.manager.mu.Unlock()
+		close(l.released)
+	})
+}
+
+func writeConflict(w http.ResponseWriter, err *conflictError) {
+	writeJSON(w, http.StatusConflict, struct {
+		Error  string     `json:"error"`
+		Holder lockHolder `json:"holder"`
+	}{
+		Error:  err.Error(),
+		Holder: err.holder,
+	})
+}
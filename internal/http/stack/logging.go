@@ -16,3 +16,7 @@ func logStackOpError(r *http.Request, action, stack string, err error) {
 	}
 	log.Printf("stack %s %s action=%s stack=%q from=%s err=%v", r.Method, r.URL.Path, action, stack, r.RemoteAddr, err)
 }
+
+func logStackJob(r *http.Request, action, stack, job string) {
+	log.Printf("stack %s %s action=%s stack=%q job=%s from=%s", r.Method, r.URL.Path, action, stack, job, r.RemoteAddr)
+}
@@ -0,0 +1,173 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"vestri-worker/internal/backend"
+)
+
+const (
+	// defaultLogTail applies when a request names no tail; tail=all asks for
+	// the whole log.
+	defaultLogTail = "1000"
+	// maxLogOutput caps the log bytes buffered for a non-streamed response.
+	maxLogOutput = 4 << 20
+)
+
+var validService = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+func parseServices(values []string) ([]string, error) {
+	var services []string
+	for _, value := range values {
+		for _, service := range strings.Split(value, ",") {
+			service = strings.TrimSpace(service)
+			if service == "" {
+				continue
+			}
+			if !validService.MatchString(service) {
+				return nil, fmt.Errorf("invalid service name")
+			}
+			services = append(services, service)
+		}
+	}
+	return services, nil
+}
+
+func parseLogsRequest(r *http.Request) (backend.LogsOptions, error) {
+	query := r.URL.Query()
+	req := backend.LogsOptions{Tail: defaultLogTail}
+
+	if tail := strings.TrimSpace(query.Get("tail")); tail != "" {
+		if n, err := strconv.Atoi(tail); (err != nil || n < 0) && tail != "all" {
+			return req, fmt.Errorf("invalid tail")
+		}
+		req.Tail = tail
+	}
+
+	if since := strings.TrimSpace(query.Get("since")); since != "" {
+		ts, err := parseSince(since, time.Now())
+		if err != nil {
+			return req, err
+		}
+		req.Since = ts
+	}
+
+	req.Timestamps = parseBool(query.Get("timestamps"))
+	req.Follow = parseBool(query.Get("follow"))
+
+	services, err := parseServices(query["service"])
+	if err != nil {
+		return req, err
+	}
+	req.Services = services
+
+	return req, nil
+}
+
+func parseSince(value string, now time.Time) (int64, error) {
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d).Unix(), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t.Unix(), nil
+	}
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil && ts >= 0 {
+		return ts, nil
+	}
+	return 0, fmt.Errorf("invalid since")
+}
+
+func parseBool(value string) bool {
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	return err == nil && b
+}
+
+func StackLogsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req stackRequest
+	stackPath, err := parseStackName(r, &req)
+	if err != nil {
+		logStackOpError(r, "logs", "", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	opts, err := parseLogsRequest(r)
+	if err != nil {
+		logStackOpError(r, "logs", stackName, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	follow := opts.Follow
+
+	rt, project, err := openStack(stackPath)
+	if err != nil {
+		logStackOpError(r, "logs", stackName, err)
+		http.Error(w, err.Error(), openStackStatus(err))
+		return
+	}
+
+	mode, err := streamMode(r, r.URL.Query().Get("stream"))
+	if err != nil {
+		logStackOpError(r, "logs", stackName, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if follow && mode == "" {
+		mode = streamText
+	}
+
+	if mode == "" {
+		ctx, cancel := context.WithTimeout(r.Context(), composeTimeout)
+		defer cancel()
+
+		out := &limitedBuffer{max: maxLogOutput}
+		if err := rt.Logs(ctx, project, opts, out); err != nil {
+			logStackOpError(r, "logs", stackName, err)
+			writeCommandError(w, out.buf.String(), err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(out.buf.Bytes())
+		logStackOp(r, "logs", stackName)
+		return
+	}
+
+	ctx := r.Context()
+	if !follow {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, composeTimeout)
+		defer cancel()
+	}
+
+	stream, err := newStreamWriter(w, mode)
+	if err != nil {
+		logStackOpError(r, "logs", stackName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logStackOp(r, "logs", stackName)
+
+	err = rt.Logs(ctx, project, opts, stream)
+	if r.Context().Err() != nil {
+		return
+	}
+	stream.Close(err)
+	if err != nil {
+		logStackOpError(r, "logs", stackName, err)
+	}
+}
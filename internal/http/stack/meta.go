@@ -0,0 +1,346 @@
+package stack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"vestri-worker/internal/http/fs"
+	"vestri-worker/internal/query"
+)
+
+const (
+	metaFileName      = fs.StackMetaFileName
+	metaSchemaVersion = 1
+
+	desiredRunning = "running"
+	desiredStopped = "stopped"
+
+	maxMetaField       = 256
+	maxMetaDescription = 4096
+	maxMetaLabels      = 64
+)
+
+var validLabelKey = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.\-/]{0,62}$`)
+
+// stackMeta is the stack's vestri.json. It is written only by the worker:
+// /stack/meta and the endpoints managing single sections of it.
+type stackMeta struct {
+	Version      int               `json:"version,omitempty"`
+	DisplayName  string            `json:"display_name,omitempty"`
+	Description  string            `json:"description,omitempty"`
+	Owner        string            `json:"owner,omitempty"`
+	Game         string            `json:"game,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	DesiredState string            `json:"desired_state,omitempty"`
+	Autostart    bool              `json:"autostart,omitempty"`
+	CreatedAt    *time.Time        `json:"created_at,omitempty"`
+	UpdatedAt    *time.Time        `json:"updated_at,omitempty"`
+
+	Template     string     `json:"template,omitempty"`
+	ComposeFiles []string   `json:"compose_files,omitempty"`
+	SecretEnv    []string   `json:"secret_env,omitempty"`
+	Rcon         *rconMeta  `json:"rcon,omitempty"`
+	Query        *queryMeta `json:"query,omitempty"`
+	Stop         *stopMeta  `json:"stop,omitempty"`
+}
+
+// rconMeta locates a stack's RCON listener. Values left empty are read from
+// the stack's .env using PortEnv and PasswordEnv.
+type rconMeta struct {
+	Host        string `json:"host,omitempty"`
+	Port        int    `json:"port,omitempty"`
+	PortEnv     string `json:"port_env,omitempty"`
+	Password    string `json:"password,omitempty"`
+	PasswordEnv string `json:"password_env,omitempty"`
+}
+
+// queryMeta selects the status protocol ("a2s" or "minecraft") and where the
+// server answers it. Port falls back to PortEnv in the stack's .env.
+type queryMeta struct {
+	Protocol string `json:"protocol"`
+	Host     string `json:"host,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	PortEnv  string `json:"port_env,omitempty"`
+}
+
+// stopMeta describes how a stack is shut down: an optional pre-stop command,
+// a pause to let it take effect, and the compose stop timeout.
+type stopMeta struct {
+	PreStop        *preStopMeta `json:"pre_stop,omitempty"`
+	WaitSeconds    int          `json:"wait_seconds,omitempty"`
+	TimeoutSeconds int          `json:"timeout_seconds,omitempty"`
+}
+
+// preStopMeta is sent to the service console, over RCON, or run with exec
+// depending on Type.
+type preStopMeta struct {
+	Type    string `json:"type"`
+	Service string `json:"service,omitempty"`
+	Command string `json:"command"`
+}
+
+func loadStackMeta(stackPath string) (stackMeta, error) {
+	var meta stackMeta
+
+	data, err := os.ReadFile(filepath.Join(stackPath, metaFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return meta, nil
+		}
+		return meta, err
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, err
+	}
+	return meta, nil
+}
+
+// saveStackMeta writes meta, keeping any fields of the current document that
+// stackMeta does not know, such as those written by a newer worker.
+func saveStackMeta(stackPath string, meta stackMeta) error {
+	path := filepath.Join(stackPath, metaFileName)
+	now := time.Now().UTC().Truncate(time.Second)
+	meta.Version = metaSchemaVersion
+	if meta.CreatedAt == nil {
+		meta.CreatedAt = &now
+	}
+	meta.UpdatedAt = &now
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if existing, err := os.ReadFile(path); err == nil {
+		var current map[string]json.RawMessage
+		if json.Unmarshal(existing, &current) == nil {
+			for key, value := range current {
+				if !metaFields[key] {
+					doc[key] = value
+				}
+			}
+		}
+	}
+
+	data, err = json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The document may hold the RCON password, so it is never left readable
+	// by others even if an older worker created it 0644.
+	return writeFileMode(path, append(data, '\n'), 0600)
+}
+
+// metaFields are the top-level keys of vestri.json owned by stackMeta.
+var metaFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(stackMeta{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name] = true
+	}
+	return fields
+}()
+
+type metaRequest struct {
+	stackRequest
+	Meta *stackMeta `json:"meta"`
+}
+
+type metaResponse struct {
+	Stack string    `json:"stack"`
+	Meta  stackMeta `json:"meta"`
+}
+
+func StackMetaHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		stackMetaGet(w, r)
+	case http.MethodPut:
+		stackMetaPut(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func stackMetaGet(w http.ResponseWriter, r *http.Request) {
+	var req stackRequest
+	stackPath, err := parseExistingStack(r, &req)
+	if err != nil {
+		logStackOpError(r, "meta", "", err)
+		http.Error(w, err.Error(), stackErrorStatus(err))
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	meta, err := loadStackMeta(stackPath)
+	if err != nil {
+		logStackOpError(r, "meta", stackName, err)
+		http.Error(w, "invalid stack metadata", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, metaResponse{Stack: stackName, Meta: meta.masked()})
+	logStackOp(r, "meta", stackName)
+}
+
+// stackMetaPut replaces the document. The worker-managed template,
+// compose_files and secret_env sections and the creation time are kept, and a masked RCON password leaves the stored one in place so a
+// GET/PUT round trip does not lose it.
+func stackMetaPut(w http.ResponseWriter, r *http.Request) {
+	var req metaRequest
+	stackPath, err := parseExistingStack(r, &req)
+	if err != nil {
+		logStackOpError(r, "meta", "", err)
+		http.Error(w, err.Error(), stackErrorStatus(err))
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	if req.Meta == nil {
+		http.Error(w, "meta is required", http.StatusBadRequest)
+		return
+	}
+	if err := req.Meta.validate(stackPath); err != nil {
+		logStackOpError(r, "meta", stackName, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lock, conflict := lockStack(r, stackName, "meta", false)
+	if conflict != nil {
+		logStackOpError(r, "meta", stackName, conflict)
+		writeConflict(w, conflict)
+		return
+	}
+	defer lock.release()
+
+	current, err := loadStackMeta(stackPath)
+	if err != nil {
+		logStackOpError(r, "meta", stackName, err)
+		http.Error(w, "invalid stack metadata", http.StatusInternalServerError)
+		return
+	}
+
+	meta := *req.Meta
+	meta.Template = current.Template
+	meta.ComposeFiles = current.ComposeFiles
+	meta.SecretEnv = current.SecretEnv
+	meta.CreatedAt = current.CreatedAt
+	if meta.Rcon != nil && meta.Rcon.Password == maskedValue {
+		meta.Rcon.Password = ""
+		if current.Rcon != nil {
+			meta.Rcon.Password = current.Rcon.Password
+		}
+	}
+	if err := saveStackMeta(stackPath, meta); err != nil {
+		logStackOpError(r, "meta", stackName, err)
+		http.Error(w, "cannot write stack metadata", http.StatusInternalServerError)
+		return
+	}
+	rconPool.Forget(stackName)
+
+	meta, err = loadStackMeta(stackPath)
+	if err != nil {
+		logStackOpError(r, "meta", stackName, err)
+		http.Error(w, "invalid stack metadata", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, metaResponse{Stack: stackName, Meta: meta.masked()})
+	logStackOp(r, "meta", stackName)
+}
+
+func (m stackMeta) masked() stackMeta {
+	if m.Rcon != nil && m.Rcon.Password != "" {
+		rcon := *m.Rcon
+		rcon.Password = maskedValue
+		m.Rcon = &rcon
+	}
+	return m
+}
+
+func (m *stackMeta) validate(stackPath string) error {
+	for _, field := range []struct {
+		name, value string
+	}{
+		{"display_name", m.DisplayName},
+		{"owner", m.Owner},
+		{"game", m.Game},
+	} {
+		if len(field.value) > maxMetaField || strings.ContainsAny(field.value, "\r\n\x00") {
+			return fmt.Errorf("invalid %s", field.name)
+		}
+	}
+	if len(m.Description) > maxMetaDescription {
+		return fmt.Errorf("description must be at most %d bytes", maxMetaDescription)
+	}
+	if len(m.Labels) > maxMetaLabels {
+		return fmt.Errorf("at most %d labels are allowed", maxMetaLabels)
+	}
+	for key, value := range m.Labels {
+		if !validLabelKey.MatchString(key) {
+			return fmt.Errorf("invalid label key %q", key)
+		}
+		if len(value) > maxMetaField || strings.ContainsAny(value, "\r\n\x00") {
+			return fmt.Errorf("invalid value for label %q", key)
+		}
+	}
+	if m.DesiredState != "" && m.DesiredState != desiredRunning && m.DesiredState != desiredStopped {
+		return fmt.Errorf("desired_state must be running or stopped")
+	}
+
+	for _, name := range m.ComposeFiles {
+		file, err := fs.SafePath(stackPath, name)
+		if err != nil || file == stackPath {
+			return fmt.Errorf("invalid compose file %q", name)
+		}
+	}
+	for _, key := range m.SecretEnv {
+		if !validEnvKey.MatchString(key) {
+			return fmt.Errorf("invalid secret_env key %q", key)
+		}
+	}
+	if rcon := m.Rcon; rcon != nil {
+		if rcon.Port < 0 || rcon.Port > 65535 {
+			return fmt.Errorf("invalid rcon port %d", rcon.Port)
+		}
+		if rcon.PortEnv != "" && !validEnvKey.MatchString(rcon.PortEnv) || rcon.PasswordEnv != "" && !validEnvKey.MatchString(rcon.PasswordEnv) {
+			return fmt.Errorf("invalid rcon env key")
+		}
+		if !validTargetHost(rcon.Host) {
+			return fmt.Errorf("rcon host must be an IP address")
+		}
+	}
+	if q := m.Query; q != nil {
+		protocol := strings.ToLower(q.Protocol)
+		if protocol != query.ProtocolA2S && protocol != query.ProtocolMinecraft {
+			return fmt.Errorf("unsupported query protocol %q", q.Protocol)
+		}
+		if q.Port < 0 || q.Port > 65535 {
+			return fmt.Errorf("invalid query port %d", q.Port)
+		}
+		if q.PortEnv != "" && !validEnvKey.MatchString(q.PortEnv) {
+			return fmt.Errorf("invalid query port_env %q", q.PortEnv)
+		}
+		if !validTargetHost(q.Host) {
+			return fmt.Errorf("query host must be an IP address")
+		}
+	}
+	if m.Stop != nil {
+		if err := m.Stop.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package stack
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestStackMetaPutKeepsManagedFields(t *testing.T) {
+	_, stackPath := newTestStack(t, "game", map[string]string{"app": "nginx"})
+
+	path := filepath.Join(stackPath, metaFileName)
+	if err := os.WriteFile(path, []byte(`{"template":"minecraft","compose_files":["compose.yaml"],"secret_env":["RCON_PASSWORD"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"stack":"game","meta":{"display_name":"Game","template":"other","compose_files":["x.yaml"],"secret_env":["OTHER"]}}`
+	if w := serve(StackMetaHandler, http.MethodPut, "/stack/meta", body); w.Code != http.StatusOK {
+		t.Fatalf("put: %d %s", w.Code, w.Body)
+	}
+
+	meta, err := loadStackMeta(stackPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.DisplayName != "Game" || meta.Template != "minecraft" {
+		t.Errorf("meta = %+v", meta)
+	}
+	if !slices.Equal(meta.ComposeFiles, []string{"compose.yaml"}) || !slices.Equal(meta.SecretEnv, []string{"RCON_PASSWORD"}) {
+		t.Errorf("compose_files %v, secret_env %v", meta.ComposeFiles, meta.SecretEnv)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("mode = %o, want 600", mode)
+	}
+}
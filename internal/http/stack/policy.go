@@ -0,0 +1,104 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"vestri-worker/internal/backend"
+	"vestri-worker/internal/policy"
+	"vestri-worker/internal/settings"
+)
+
+type policyResponse struct {
+	Error      string             `json:"error"`
+	Stack      string             `json:"stack"`
+	Violations []policy.Violation `json:"violations"`
+}
+
+func policyRules(s settings.Settings) policy.Rules {
+	return policy.Rules{
+		AllowPrivileged:     s.PolicyAllowPrivileged,
+		AllowedCapabilities: s.PolicyAllowedCaps,
+		AllowHostNetwork:    s.PolicyAllowHostNetwork,
+		AllowHostPID:        s.PolicyAllowHostPID,
+		AllowHostIPC:        s.PolicyAllowHostIPC,
+		AllowDevices:        s.PolicyAllowDevices,
+		AllowUnconfined:     s.PolicyAllowUnconfined,
+		AllowHostUserns:     s.PolicyAllowHostUserns,
+		AllowHostCgroup:     s.PolicyAllowHostCgroup,
+		AllowCgroupParent:   s.PolicyAllowCgParent,
+		AllowHostUTS:        s.PolicyAllowHostUTS,
+		AllowContainerNS:    s.PolicyAllowContainerNS,
+		AllowVolumesFrom:    s.PolicyAllowVolumesFrom,
+		AllowExtVolumes:     s.PolicyAllowExtVolumes,
+		AllowedBindPaths:    s.PolicyAllowedBindPaths,
+	}
+}
+
+const checkedConfigSuffix = ".compose.json"
+
+// checkedConfigPath is where the configuration a stack was last started with
+// is kept, next to the resource overrides and outside FsBasePath.
+func checkedConfigPath(stackName string) string {
+	return filepath.Join(settings.Get().ResourceOverrideDir, stackName+checkedConfigSuffix)
+}
+
+// checkedProject resolves the stack's compose configuration once, checks it
+// against the policy and returns a project that runs exactly that
+// configuration. The stack's files can still change through /fs, so compose
+// must not read them again after the check. It fails with a *policy.Error
+// when the policy forbids something, and returns project unchanged when the
+// policy is disabled. Actions call it under the stack lock right before
+// compose starts containers.
+func checkedProject(ctx context.Context, rt backend.Backend, project backend.Project) (backend.Project, error) {
+	s := settings.Get()
+	if !s.PolicyEnabled {
+		return project, nil
+	}
+
+	config, _, err := rt.Config(ctx, project)
+	if err != nil {
+		return project, err
+	}
+	violations, err := policy.Check(config, project.Dir, policyRules(s))
+	if err != nil {
+		return project, err
+	}
+	if len(violations) > 0 {
+		return project, &policy.Error{Violations: violations}
+	}
+
+	// The resolved config holds interpolated .env values, secrets included.
+	path := checkedConfigPath(project.Name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return project, err
+	}
+	if err := writeFileMode(path, config, 0600); err != nil {
+		return project, err
+	}
+	project.Files = []string{path}
+	return project, nil
+}
+
+// writePolicyError answers err when it comes from checkedProject and reports
+// whether it did.
+func writePolicyError(w http.ResponseWriter, stackName string, err error) bool {
+	var policyErr *policy.Error
+	if errors.As(err, &policyErr) {
+		writeJSON(w, http.StatusUnprocessableEntity, policyResponse{
+			Error:      "compose policy violation",
+			Stack:      stackName,
+			Violations: policyErr.Violations,
+		})
+		return true
+	}
+	var configErr *backend.ConfigError
+	if errors.As(err, &configErr) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,289 @@
+package stack
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"vestri-worker/internal/ports"
+	"vestri-worker/internal/settings"
+)
+
+var portState struct {
+	sync.Mutex
+	key       string
+	allocator *ports.Allocator
+}
+
+type portsRequest struct {
+	stackRequest
+	Ports []ports.Request `json:"ports"`
+}
+
+type portsReleaseRequest struct {
+	stackRequest
+	Names []string `json:"names"`
+}
+
+type portsResponse struct {
+	Stack string             `json:"stack"`
+	Ports []ports.Assignment `json:"ports"`
+}
+
+type portsOverview struct {
+	TCPRange    ports.Range        `json:"tcp_range"`
+	UDPRange    ports.Range        `json:"udp_range"`
+	Assignments []ports.Assignment `json:"assignments"`
+}
+
+// portAllocator returns the allocator for the current settings, rebuilding it
+// when the ranges or state file change.
+func portAllocator() (*ports.Allocator, error) {
+	s := settings.Get()
+	key := s.PortStateFile + "|" + s.PortRangeTCP + "|" + s.PortRangeUDP
+
+	portState.Lock()
+	defer portState.Unlock()
+	if portState.allocator != nil && portState.key == key {
+		return portState.allocator, nil
+	}
+
+	tcp, err := ports.ParseRange(s.PortRangeTCP)
+	if err != nil {
+		return nil, err
+	}
+	udp, err := ports.ParseRange(s.PortRangeUDP)
+	if err != nil {
+		return nil, err
+	}
+	portState.key = key
+	portState.allocator = ports.New(s.PortStateFile, tcp, udp)
+	return portState.allocator, nil
+}
+
+func PortsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	allocator, err := portAllocator()
+	if err != nil {
+		logStackOpError(r, "ports", "", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	assignments, err := allocator.List("")
+	if err != nil {
+		logStackOpError(r, "ports", "", err)
+		http.Error(w, "cannot read port state", http.StatusInternalServerError)
+		return
+	}
+
+	tcp, udp := allocator.Ranges()
+	writeJSON(w, http.StatusOK, portsOverview{TCPRange: tcp, UDPRange: udp, Assignments: assignments})
+	logStackOp(r, "ports", "")
+}
+
+func StackPortsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		stackPortsGet(w, r)
+	case http.MethodPost:
+		stackPortsAllocate(w, r)
+	case http.MethodDelete:
+		stackPortsRelease(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func stackPortsGet(w http.ResponseWriter, r *http.Request) {
+	var req stackRequest
+	stackPath, err := resolveStackName(r, &req)
+	if err != nil {
+		logStackOpError(r, "ports", "", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	allocator, err := portAllocator()
+	if err != nil {
+		logStackOpError(r, "ports", stackName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	assignments, err := allocator.List(stackName)
+	if err != nil {
+		logStackOpError(r, "ports", stackName, err)
+		http.Error(w, "cannot read port state", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, portsResponse{Stack: stackName, Ports: assignments})
+	logStackOp(r, "ports", stackName)
+}
+
+func stackPortsAllocate(w http.ResponseWriter, r *http.Request) {
+	var req portsRequest
+	stackPath, err := parseExistingStack(r, &req)
+	if err != nil {
+		logStackOpError(r, "ports allocate", "", err)
+		http.Error(w, err.Error(), stackErrorStatus(err))
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	if len(req.Ports) == 0 {
+		http.Error(w, "ports is required", http.StatusBadRequest)
+		return
+	}
+	seen := make(map[string]bool, len(req.Ports))
+	for _, p := range req.Ports {
+		if !validEnvKey.MatchString(p.Name) {
+			http.Error(w, fmt.Sprintf("invalid port name %q", p.Name), http.StatusBadRequest)
+			return
+		}
+		if seen[p.Name] {
+			http.Error(w, fmt.Sprintf("duplicate port name %q", p.Name), http.StatusBadRequest)
+			return
+		}
+		seen[p.Name] = true
+	}
+
+	allocator, err := portAllocator()
+	if err != nil {
+		logStackOpError(r, "ports allocate", stackName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	lock, conflict := lockStack(r, stackName, "ports", false)
+	if conflict != nil {
+		logStackOpError(r, "ports allocate", stackName, conflict)
+		writeConflict(w, conflict)
+		return
+	}
+	defer lock.release()
+
+	env, err := loadEnvFile(stackPath)
+	if err != nil {
+		logStackOpError(r, "ports allocate", stackName, err)
+		http.Error(w, "cannot read env file", http.StatusInternalServerError)
+		return
+	}
+
+	held, err := allocator.List(stackName)
+	if err != nil {
+		logStackOpError(r, "ports allocate", stackName, err)
+		http.Error(w, "cannot read port state", http.StatusInternalServerError)
+		return
+	}
+	assignments, err := allocator.Allocate(stackName, req.Ports)
+	if err != nil {
+		logStackOpError(r, "ports allocate", stackName, err)
+		http.Error(w, err.Error(), portsErrorStatus(err))
+		return
+	}
+
+	for _, as := range assignments {
+		env.Set(as.Name, fmt.Sprint(as.Port))
+	}
+	if err := env.Save(stackPath); err != nil {
+		// Put back what the stack held before, so the state file matches the
+		// .env that was never rewritten.
+		if names := newAssignments(held, assignments); len(names) > 0 {
+			if restoreErr := allocator.Restore(stackName, names, held); restoreErr != nil {
+				logStackOpError(r, "ports allocate", stackName, restoreErr)
+			}
+		}
+		logStackOpError(r, "ports allocate", stackName, err)
+		http.Error(w, "cannot write env file", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, portsResponse{Stack: stackName, Ports: assignments})
+	logStackOp(r, "ports allocate", stackName)
+}
+
+func stackPortsRelease(w http.ResponseWriter, r *http.Request) {
+	var req portsReleaseRequest
+	stackPath, err := parseExistingStack(r, &req)
+	if err != nil {
+		logStackOpError(r, "ports release", "", err)
+		http.Error(w, err.Error(), stackErrorStatus(err))
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	allocator, err := portAllocator()
+	if err != nil {
+		logStackOpError(r, "ports release", stackName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	lock, conflict := lockStack(r, stackName, "ports", false)
+	if conflict != nil {
+		logStackOpError(r, "ports release", stackName, conflict)
+		writeConflict(w, conflict)
+		return
+	}
+	defer lock.release()
+
+	env, err := loadEnvFile(stackPath)
+	if err != nil {
+		logStackOpError(r, "ports release", stackName, err)
+		http.Error(w, "cannot read env file", http.StatusInternalServerError)
+		return
+	}
+
+	released, err := allocator.Release(stackName, req.Names)
+	if err != nil {
+		logStackOpError(r, "ports release", stackName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(released) > 0 {
+		for _, as := range released {
+			env.Unset(as.Name)
+		}
+		if err := env.Save(stackPath); err != nil {
+			logStackOpError(r, "ports release", stackName, err)
+			http.Error(w, "cannot write env file", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, portsResponse{Stack: stackName, Ports: released})
+	logStackOp(r, "ports release", stackName)
+}
+
+// newAssignments returns the names in assignments that were not held with the
+// same port and protocol before.
+func newAssignments(held, assignments []ports.Assignment) []string {
+	var names []string
+	for _, as := range assignments {
+		if !slices.ContainsFunc(held, func(h ports.Assignment) bool {
+			return h.Name == as.Name && h.Port == as.Port && h.Protocol == as.Protocol
+		}) {
+			names = append(names, as.Name)
+		}
+	}
+	return names
+}
+
+func portsErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ports.ErrExhausted), errors.Is(err, ports.ErrPortInUse):
+		return http.StatusConflict
+	case errors.Is(err, ports.ErrInvalidProtocol), errors.Is(err, ports.ErrInvalidPort), errors.Is(err, ports.ErrOutOfRange):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,177 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"vestri-worker/internal/backend"
+)
+
+type imageChange struct {
+	Service    string `json:"service"`
+	Image      string `json:"image"`
+	PreviousID string `json:"previous_id,omitempty"`
+	CurrentID  string `json:"current_id,omitempty"`
+	Changed    bool   `json:"changed"`
+	Recreated  bool   `json:"recreated,omitempty"`
+}
+
+type pullRequest struct {
+	actionRequest
+	servicesRequest
+}
+
+type pullReport struct {
+	Services []imageChange `json:"services"`
+	Changed  int           `json:"changed"`
+}
+
+func StackPullHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req pullRequest
+	stackPath, err := parseStackName(r, &req)
+	if err != nil {
+		logStackOpError(r, "pull", "", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	if err := req.normalize(); err != nil {
+		logStackOpError(r, "pull", stackName, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rt, project, err := openStack(stackPath)
+	if err != nil {
+		logStackOpError(r, "pull", stackName, err)
+		http.Error(w, err.Error(), openStackStatus(err))
+		return
+	}
+
+	serveStackResult(w, r, "pull", stackName, &req.actionRequest, func(ctx context.Context, out io.Writer) (any, error) {
+		report, err := pullImages(ctx, rt, project, req.Services, out)
+		if report == nil {
+			return nil, err
+		}
+		return report, err
+	})
+}
+
+func StackUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req pullRequest
+	stackPath, err := parseStackName(r, &req)
+	if err != nil {
+		logStackOpError(r, "update", "", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	if err := req.normalize(); err != nil {
+		logStackOpError(r, "update", stackName, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rt, project, err := openStack(stackPath)
+	if err != nil {
+		logStackOpError(r, "update", stackName, err)
+		http.Error(w, err.Error(), openStackStatus(err))
+		return
+	}
+
+	serveStackResult(w, r, "update", stackName, &req.actionRequest, func(ctx context.Context, out io.Writer) (any, error) {
+		report, err := pullImages(ctx, rt, project, req.Services, out)
+		if report == nil {
+			return nil, err
+		}
+		if err != nil || report.Changed == 0 {
+			return report, err
+		}
+
+		containers, err := rt.Containers(ctx, project)
+		if err != nil {
+			return report, err
+		}
+		existing := make(map[string]bool)
+		for _, c := range containers {
+			existing[c.Service] = true
+		}
+
+		var recreate []string
+		for i, change := range report.Services {
+			if change.Changed && existing[change.Service] {
+				recreate = append(recreate, change.Service)
+				report.Services[i].Recreated = true
+			}
+		}
+		if len(recreate) == 0 {
+			return report, nil
+		}
+
+		planned, err := withResourcePlan(ctx, rt, project)
+		if err != nil {
+			return report, err
+		}
+		if planned, err = checkedProject(ctx, rt, planned); err != nil {
+			return report, err
+		}
+		opts := backend.UpOptions{Services: recreate, ForceRecreate: true, NoDeps: true}
+		if err := rt.Up(ctx, planned, opts, out); err != nil {
+			return report, fmt.Errorf("up: %w", err)
+		}
+		return report, nil
+	})
+}
+
+func pullImages(ctx context.Context, rt backend.Backend, project backend.Project, services []string, out io.Writer) (*pullReport, error) {
+	config, err := loadComposeConfig(ctx, rt, project)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	report := &pullReport{Services: []imageChange{}}
+	for name, service := range config.Services {
+		if service.Image == "" || len(services) > 0 && !slices.Contains(services, name) {
+			continue
+		}
+		report.Services = append(report.Services, imageChange{Service: name, Image: service.Image})
+	}
+	sort.Slice(report.Services, func(i, j int) bool {
+		return report.Services[i].Service < report.Services[j].Service
+	})
+
+	for i := range report.Services {
+		report.Services[i].PreviousID, _ = rt.ImageID(ctx, report.Services[i].Image)
+	}
+
+	if err := rt.Pull(ctx, project, services, out); err != nil {
+		return report, fmt.Errorf("pull: %w", err)
+	}
+
+	for i := range report.Services {
+		change := &report.Services[i]
+		change.CurrentID, _ = rt.ImageID(ctx, change.Image)
+		if change.CurrentID != "" && change.CurrentID != change.PreviousID {
+			change.Changed = true
+			report.Changed++
+		}
+	}
+	return report, nil
+}
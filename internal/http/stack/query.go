@@ -0,0 +1,189 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vestri-worker/internal/ports"
+	"vestri-worker/internal/query"
+)
+
+const (
+	queryTimeout        = 3 * time.Second
+	queryCacheTTL       = 5 * time.Second
+	defaultQueryHost    = "127.0.0.1"
+	defaultQueryPortEnv = "QUERY_PORT"
+)
+
+var (
+	queryCache = queryCacheStore{entries: make(map[string]queryCacheEntry)}
+
+	errQueryNotConfigured = errors.New("query is not configured for this stack")
+)
+
+type queryCacheStore struct {
+	mu      sync.Mutex
+	entries map[string]queryCacheEntry
+}
+
+type queryCacheEntry struct {
+	target string
+	info   *query.Info
+	err    error
+	at     time.Time
+}
+
+type queryResponse struct {
+	Stack     string    `json:"stack"`
+	Cached    bool      `json:"cached"`
+	QueriedAt time.Time `json:"queried_at"`
+	*query.Info
+}
+
+func StackQueryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req stackRequest
+	stackPath, err := parseExistingStack(r, &req)
+	if err != nil {
+		logStackOpError(r, "query", "", err)
+		http.Error(w, err.Error(), stackErrorStatus(err))
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	ctx, cancel := context.WithTimeout(r.Context(), queryTimeout)
+	protocol, addr, err := queryTarget(ctx, stackPath)
+	cancel()
+	if err != nil {
+		logStackOpError(r, "query", stackName, err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, errQueryNotConfigured) || errors.Is(err, errTargetHost) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	target := protocol + " " + addr
+	entry, cached := queryCache.get(stackName, target)
+	if !cached || parseBool(r.URL.Query().Get("refresh")) {
+		ctx, cancel := context.WithTimeout(r.Context(), queryTimeout)
+		info, err := queryServer(ctx, protocol, addr)
+		cancel()
+		entry = queryCache.put(stackName, target, info, err)
+		cached = false
+	}
+
+	if entry.err != nil {
+		logStackOpError(r, "query", stackName, entry.err)
+		status := http.StatusBadGateway
+		var netErr net.Error
+		if errors.As(entry.err, &netErr) && netErr.Timeout() || errors.Is(entry.err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+		http.Error(w, entry.err.Error(), status)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, queryResponse{
+		Stack:     stackName,
+		Cached:    cached,
+		QueriedAt: entry.at,
+		Info:      entry.info,
+	})
+	logStackOp(r, "query", stackName)
+}
+
+func queryServer(ctx context.Context, protocol, addr string) (*query.Info, error) {
+	switch protocol {
+	case query.ProtocolA2S:
+		return query.A2S(ctx, addr, queryTimeout)
+	case query.ProtocolMinecraft:
+		return query.Minecraft(ctx, addr, "", queryTimeout)
+	}
+	return nil, fmt.Errorf("unsupported query protocol %q", protocol)
+}
+
+func queryTarget(ctx context.Context, stackPath string) (string, string, error) {
+	meta, err := loadStackMeta(stackPath)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid stack metadata: %w", err)
+	}
+	if meta.Query == nil || meta.Query.Protocol == "" {
+		return "", "", errQueryNotConfigured
+	}
+	cfg := *meta.Query
+	cfg.Protocol = strings.ToLower(cfg.Protocol)
+	if cfg.Protocol != query.ProtocolA2S && cfg.Protocol != query.ProtocolMinecraft {
+		return "", "", fmt.Errorf("unsupported query protocol %q", cfg.Protocol)
+	}
+	if cfg.Host == "" {
+		cfg.Host = defaultQueryHost
+	}
+	if cfg.PortEnv == "" {
+		cfg.PortEnv = defaultQueryPortEnv
+	}
+
+	if cfg.Port == 0 {
+		env, err := loadEnvFile(stackPath)
+		if err != nil {
+			return "", "", fmt.Errorf("cannot read env file: %w", err)
+		}
+		value, ok := env.Get(cfg.PortEnv)
+		if !ok {
+			return "", "", errQueryNotConfigured
+		}
+		if cfg.Port, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+			return "", "", fmt.Errorf("invalid %s: %q", cfg.PortEnv, value)
+		}
+	}
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		return "", "", fmt.Errorf("invalid query port %d", cfg.Port)
+	}
+	protocol := ports.ProtocolTCP
+	if cfg.Protocol == query.ProtocolA2S {
+		protocol = ports.ProtocolUDP
+	}
+	if err := checkTarget(ctx, stackPath, cfg.Host, cfg.Port, protocol); err != nil {
+		return "", "", err
+	}
+	return cfg.Protocol, net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)), nil
+}
+
+func (c *queryCacheStore) get(stack, target string) (queryCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[stack]
+	if !ok || entry.target != target || time.Since(entry.at) > queryCacheTTL {
+		return queryCacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *queryCacheStore) put(stack, target string, info *query.Info, err error) queryCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now().UTC()
+	for key, entry := range c.entries {
+		if now.Sub(entry.at) > queryCacheTTL {
+			delete(c.entries, key)
+		}
+	}
+	entry := queryCacheEntry{target: target, info: info, err: err, at: now}
+	c.entries[stack] = entry
+	return entry
+}
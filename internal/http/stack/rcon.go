@@ -0,0 +1,229 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"vestri-worker/internal/backend"
+	"vestri-worker/internal/ports"
+	"vestri-worker/internal/rcon"
+)
+
+const (
+	rconTimeout         = 10 * time.Second
+	rconIdleTimeout     = 5 * time.Minute
+	defaultRconHost     = "127.0.0.1"
+	defaultRconPortEnv  = "RCON_PORT"
+	defaultRconPassEnv  = "RCON_PASSWORD"
+	maxRconCommandBytes = 4096
+)
+
+var (
+	rconPool = rcon.NewPool(rconTimeout, rconIdleTimeout)
+
+	errRconNotConfigured = errors.New("rcon is not configured for this stack")
+	errTargetHost        = errors.New("target must be one of the stack's containers or a port the stack publishes on loopback")
+)
+
+type rconRequest struct {
+	stackRequest
+	Command string `json:"command"`
+}
+
+type rconResponse struct {
+	Stack    string `json:"stack"`
+	Command  string `json:"command"`
+	Response string `json:"response"`
+}
+
+func StackRconHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRconCommandBytes+1024)
+
+	var req rconRequest
+	stackPath, err := parseExistingStack(r, &req)
+	if err != nil {
+		logStackOpError(r, "rcon", "", err)
+		http.Error(w, err.Error(), stackErrorStatus(err))
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	if strings.TrimSpace(req.Command) == "" || strings.ContainsAny(req.Command, "\r\n\x00") {
+		logStackOpError(r, "rcon", stackName, fmt.Errorf("invalid command"))
+		http.Error(w, "invalid command", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), rconTimeout)
+	defer cancel()
+
+	response, err := rconCommand(ctx, stackPath, stackName, req.Command)
+	if err != nil {
+		logStackOpError(r, "rcon", stackName, err)
+		http.Error(w, err.Error(), rconErrorStatus(err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rconResponse{Stack: stackName, Command: req.Command, Response: response})
+	logStackOp(r, "rcon", stackName)
+}
+
+func rconCommand(ctx context.Context, stackPath, stackName, command string) (string, error) {
+	addr, password, err := rconTarget(ctx, stackPath)
+	if err != nil {
+		return "", err
+	}
+	return rconPool.Execute(ctx, stackName, addr, password, command)
+}
+
+// rconTarget resolves the RCON address and password from the stack metadata,
+// falling back to RCON_PORT and RCON_PASSWORD in the stack's .env.
+func rconTarget(ctx context.Context, stackPath string) (string, string, error) {
+	meta, err := loadStackMeta(stackPath)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid stack metadata: %w", err)
+	}
+	cfg := rconMeta{}
+	if meta.Rcon != nil {
+		cfg = *meta.Rcon
+	}
+	if cfg.Host == "" {
+		cfg.Host = defaultRconHost
+	}
+	if cfg.PortEnv == "" {
+		cfg.PortEnv = defaultRconPortEnv
+	}
+	if cfg.PasswordEnv == "" {
+		cfg.PasswordEnv = defaultRconPassEnv
+	}
+
+	if cfg.Port == 0 || cfg.Password == "" {
+		env, err := loadEnvFile(stackPath)
+		if err != nil {
+			return "", "", fmt.Errorf("cannot read env file: %w", err)
+		}
+		if cfg.Port == 0 {
+			if value, ok := env.Get(cfg.PortEnv); ok {
+				port, err := strconv.Atoi(strings.TrimSpace(value))
+				if err != nil {
+					return "", "", fmt.Errorf("invalid %s: %q", cfg.PortEnv, value)
+				}
+				cfg.Port = port
+			}
+		}
+		if cfg.Password == "" {
+			cfg.Password, _ = env.Get(cfg.PasswordEnv)
+		}
+	}
+
+	if cfg.Port == 0 || cfg.Password == "" {
+		return "", "", errRconNotConfigured
+	}
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		return "", "", fmt.Errorf("invalid rcon port %d", cfg.Port)
+	}
+	if err := checkTarget(ctx, stackPath, cfg.Host, cfg.Port, ports.ProtocolTCP); err != nil {
+		return "", "", err
+	}
+	return net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)), cfg.Password, nil
+}
+
+// checkTarget accepts an address of one of the stack's containers, or a
+// loopback host on a port the stack publishes, so that stack metadata and
+// .env cannot point the worker at other hosts, other stacks or the worker's
+// own listeners.
+func checkTarget(ctx context.Context, stackPath, host string, port int, protocol string) error {
+	if !validTargetHost(host) {
+		return errTargetHost
+	}
+
+	project, err := stackProject(stackPath)
+	if err != nil && !errors.Is(err, errNoComposeFile) {
+		return err
+	}
+	rt, err := backend.Default()
+	if err != nil {
+		return err
+	}
+	containers, err := rt.Containers(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if host == "localhost" || ip.IsLoopback() {
+		for _, c := range containers {
+			for _, p := range c.Ports {
+				if p.PublicPort == port && p.Protocol == protocol {
+					return nil
+				}
+			}
+		}
+		return checkAssignedPort(filepath.Base(stackPath), port, protocol)
+	}
+
+	for _, c := range containers {
+		for _, addr := range c.Addresses {
+			if ip.Equal(net.ParseIP(addr)) {
+				return nil
+			}
+		}
+	}
+	return errTargetHost
+}
+
+// checkAssignedPort accepts a port the allocator has assigned to the stack,
+// which covers stacks whose containers are not running yet.
+func checkAssignedPort(stackName string, port int, protocol string) error {
+	allocator, err := portAllocator()
+	if err != nil {
+		return err
+	}
+	assignments, err := allocator.List(stackName)
+	if err != nil {
+		return err
+	}
+	for _, as := range assignments {
+		if as.Port == port && (as.Protocol == protocol || as.Protocol == ports.ProtocolBoth) {
+			return nil
+		}
+	}
+	return errTargetHost
+}
+
+// validTargetHost reports whether host can name a stack's own listener. Names
+// other than localhost are refused since they may resolve anywhere.
+func validTargetHost(host string) bool {
+	return host == "" || host == "localhost" || net.ParseIP(host) != nil
+}
+
+func rconErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errRconNotConfigured), errors.Is(err, errTargetHost), errors.Is(err, rcon.ErrCommandTooLong):
+		return http.StatusBadRequest
+	case errors.Is(err, rcon.ErrAuthFailed):
+		return http.StatusBadGateway
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return http.StatusGatewayTimeout
+		}
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,49 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"vestri-worker/internal/ports"
+	"vestri-worker/internal/settings"
+)
+
+func TestCheckTarget(t *testing.T) {
+	_, stackPath := newTestStack(t, "game", map[string]string{"app": "nginx"})
+
+	state := `{"assignments":[
+		{"stack":"game","name":"RCON_PORT","protocol":"tcp","port":30005},
+		{"stack":"game","name":"GAME_PORT","protocol":"both","port":30006},
+		{"stack":"other","name":"RCON_PORT","protocol":"tcp","port":30007}
+	]}`
+	if err := os.WriteFile(settings.Get().PortStateFile, []byte(state), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host     string
+		port     int
+		protocol string
+		ok       bool
+	}{
+		{"127.0.0.1", 30005, ports.ProtocolTCP, true},
+		{"localhost", 30005, ports.ProtocolTCP, true},
+		{"127.0.0.1", 30005, ports.ProtocolUDP, false},
+		{"127.0.0.1", 30006, ports.ProtocolUDP, true},
+		{"127.0.0.1", 30007, ports.ProtocolTCP, false},
+		{"127.0.0.1", 8080, ports.ProtocolTCP, false},
+		{"10.0.0.5", 25575, ports.ProtocolTCP, false},
+		{"example.com", 30005, ports.ProtocolTCP, false},
+	}
+	for _, tt := range tests {
+		err := checkTarget(context.Background(), stackPath, tt.host, tt.port, tt.protocol)
+		if tt.ok && err != nil {
+			t.Errorf("%s:%d/%s: %v", tt.host, tt.port, tt.protocol, err)
+		}
+		if !tt.ok && !errors.Is(err, errTargetHost) {
+			t.Errorf("%s:%d/%s: err = %v, want errTargetHost", tt.host, tt.port, tt.protocol, err)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"vestri-worker/internal/backend"
+	"vestri-worker/internal/settings"
+)
+
+const (
+	resourceOverrideSuffix = ".resources.yml"
+	resourcePlanSuffix     = ".plan.json"
+	minMemoryMB            = 6
+	maxCPUs                = 1024
+)
+
+// resourcesMeta is a stack's plan. Each limit applies to every service of
+// the stack; zero leaves that limit to the compose file.
+type resourcesMeta struct {
+	CPUs        float64 `json:"cpus,omitempty"`
+	MemoryMB    int64   `json:"memory_mb,omitempty"`
+	PidsLimit   int64   `json:"pids_limit,omitempty"`
+	BlkioWeight int     `json:"blkio_weight,omitempty"`
+}
+
+// resourceLimits are the limits compose applies to one service once every
+// compose file, including the plan override, is merged.
+type resourceLimits struct {
+	CPUs        float64 `json:"cpus,omitempty"`
+	MemoryBytes int64   `json:"memory_bytes,omitempty"`
+	PidsLimit   int64   `json:"pids_limit,omitempty"`
+	BlkioWeight int     `json:"blkio_weight,omitempty"`
+}
+
+type stackResources struct {
+	Plan     *resourcesMeta            `json:"plan,omitempty"`
+	Services map[string]resourceLimits `json:"services"`
+}
+
+type resourcesRequest struct {
+	stackRequest
+	Resources *resourcesMeta `json:"resources"`
+}
+
+type resourcesResponse struct {
+	Stack     string         `json:"stack"`
+	Resources *resourcesMeta `json:"resources"`
+}
+
+func (r *resourcesMeta) validate() error {
+	switch {
+	case r.CPUs < 0 || r.CPUs > maxCPUs:
+		return fmt.Errorf("cpus must be between 0 and %d", maxCPUs)
+	case r.MemoryMB < 0 || r.MemoryMB > 0 && r.MemoryMB < minMemoryMB:
+		return fmt.Errorf("memory_mb must be at least %d", minMemoryMB)
+	case r.PidsLimit < 0:
+		return fmt.Errorf("pids_limit must not be negative")
+	case r.BlkioWeight != 0 && (r.BlkioWeight < 10 || r.BlkioWeight > 1000):
+		return fmt.Errorf("blkio_weight must be between 10 and 1000")
+	}
+	return nil
+}
+
+func (r *resourcesMeta) empty() bool {
+	return r == nil || *r == resourcesMeta{}
+}
+
+func resourceOverridePath(stackName string) string {
+	return filepath.Join(settings.Get().ResourceOverrideDir, stackName+resourceOverrideSuffix)
+}
+
+func resourcePlanPath(stackName string) string {
+	return filepath.Join(settings.Get().ResourceOverrideDir, stackName+resourcePlanSuffix)
+}
+
+// loadResourcePlan returns the stack's plan, or nil when it has none. Plans
+// are kept next to the overrides, outside FsBasePath, so customers cannot
+// raise their own limits through /fs.
+func loadResourcePlan(stackName string) (*resourcesMeta, error) {
+	data, err := os.ReadFile(resourcePlanPath(stackName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var plan resourcesMeta
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("invalid resource plan: %w", err)
+	}
+	if plan.empty() {
+		return nil, nil
+	}
+	return &plan, nil
+}
+
+// saveResourcePlan stores plan, removing the stored plan when it is empty.
+func saveResourcePlan(stackName string, plan *resourcesMeta) error {
+	path := resourcePlanPath(stackName)
+	if plan.empty() {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0644)
+}
+
+// withResourcePlan writes the stack's limits override and appends it to the
+// project's compose files. It lives outside FsBasePath and comes last, so
+// nothing a customer can upload overrides it. Stacks without a plan get any
+// stale override removed instead. Actions call it under the stack lock right
+// before compose creates containers.
+func withResourcePlan(ctx context.Context, rt backend.Backend, project backend.Project) (backend.Project, error) {
+	plan, err := loadResourcePlan(project.Name)
+	if err != nil {
+		return project, err
+	}
+	path := resourceOverridePath(project.Name)
+
+	if plan.empty() {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return project, err
+		}
+		return project, nil
+	}
+
+	config, err := loadComposeConfig(ctx, rt, project)
+	if err != nil {
+		// Compose rejects the same files again on any real command, so there
+		// is nothing to start without the limits.
+		var configErr *backend.ConfigError
+		if errors.As(err, &configErr) {
+			return project, nil
+		}
+		return project, err
+	}
+
+	services := make([]string, 0, len(config.Services))
+	for name := range config.Services {
+		services = append(services, name)
+	}
+	data, err := resourceOverride(services, *plan)
+	if err != nil {
+		return project, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return project, err
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return project, err
+	}
+
+	project.Files = append(append([]string{}, project.Files...), path)
+	return project, nil
+}
+
+// withResourceOverride appends the override last written for the stack, if
+// any, without regenerating it. Read-only views use it to report the limits
+// the running containers were created with.
+func withResourceOverride(project backend.Project) backend.Project {
+	path := resourceOverridePath(project.Name)
+	if !isRegularFile(path) {
+		return project
+	}
+	project.Files = append(append([]string{}, project.Files...), path)
+	return project
+}
+
+// resourceOverride renders the override as JSON, which compose reads as
+// YAML. Both the service level and deploy forms are set since compose
+// requires them to agree when a file uses both.
+func resourceOverride(services []string, plan resourcesMeta) ([]byte, error) {
+	sort.Strings(services)
+
+	override := make(map[string]any, len(services))
+	for _, name := range services {
+		service := map[string]any{}
+		limits := map[string]any{}
+		if plan.CPUs > 0 {
+			cpus := strconv.FormatFloat(plan.CPUs, 'f', -1, 64)
+			service["cpus"] = plan.CPUs
+			limits["cpus"] = cpus
+		}
+		if plan.MemoryMB > 0 {
+			memory := fmt.Sprintf("%dm", plan.MemoryMB)
+			service["mem_limit"] = memory
+			service["memswap_limit"] = memory
+			limits["memory"] = memory
+		}
+		if plan.PidsLimit > 0 {
+			service["pids_limit"] = plan.PidsLimit
+			limits["pids"] = plan.PidsLimit
+		}
+		if plan.BlkioWeight > 0 {
+			service["blkio_config"] = map[string]any{"weight": plan.BlkioWeight}
+		}
+		if len(limits) > 0 {
+			service["deploy"] = map[string]any{"resources": map[string]any{"limits": limits}}
+		}
+		override[name] = service
+	}
+
+	data, err := json.MarshalIndent(map[string]any{"services": override}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func effectiveLimits(config composeConfig) map[string]resourceLimits {
+	limits := make(map[string]resourceLimits, len(config.Services))
+	for name, service := range config.Services {
+		deploy := service.Deploy.Resources.Limits
+		limits[name] = resourceLimits{
+			CPUs:        float64(firstNonZero(service.CPUs, deploy.CPUs)),
+			MemoryBytes: int64(firstNonZero(service.MemLimit, deploy.Memory)),
+			PidsLimit:   int64(firstNonZero(service.PidsLimit, deploy.Pids)),
+			BlkioWeight: int(service.BlkioConfig.Weight),
+		}
+	}
+	return limits
+}
+
+func firstNonZero(values ...composeNumber) composeNumber {
+	for _, v := range values {
+		if v != 0 {
+			return v
+		}
+	}
+	return 0
+}
+
+// composeNumber accepts the numbers compose config prints either bare or as
+// strings, with an optional byte unit suffix.
+type composeNumber float64
+
+func (n *composeNumber) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	value := strings.ToLower(strings.Trim(string(data), `"`))
+	multiplier := 1.0
+	for _, unit := range []struct {
+		suffix string
+		factor float64
+	}{{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30}, {"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30}, {"b", 1}} {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSuffix(value, unit.suffix)
+			multiplier = unit.factor
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %s", data)
+	}
+	*n = composeNumber(f * multiplier)
+	return nil
+}
+
+func StackResourcesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		stackResourcesGet(w, r)
+	case http.MethodPut:
+		stackResourcesPut(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func stackResourcesGet(w http.ResponseWriter, r *http.Request) {
+	var req stackRequest
+	stackPath, err := parseExistingStack(r, &req)
+	if err != nil {
+		logStackOpError(r, "resources", "", err)
+		http.Error(w, err.Error(), stackErrorStatus(err))
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	plan, err := loadResourcePlan(stackName)
+	if err != nil {
+		logStackOpError(r, "resources", stackName, err)
+		http.Error(w, "cannot read resource plan", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resourcesResponse{Stack: stackName, Resources: plan})
+	logStackOp(r, "resources", stackName)
+}
+
+// stackResourcesPut replaces the plan. It applies from the next compose
+// command on; running containers keep their limits until recreated.
+func stackResourcesPut(w http.ResponseWriter, r *http.Request) {
+	var req resourcesRequest
+	stackPath, err := parseExistingStack(r, &req)
+	if err != nil {
+		logStackOpError(r, "resources", "", err)
+		http.Error(w, err.Error(), stackErrorStatus(err))
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	if req.Resources != nil {
+		if err := req.Resources.validate(); err != nil {
+			logStackOpError(r, "resources", stackName, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Resources.empty() {
+			req.Resources = nil
+		}
+	}
+
+	lock, conflict := lockStack(r, stackName, "resources", false)
+	if conflict != nil {
+		logStackOpError(r, "resources", stackName, conflict)
+		writeConflict(w, conflict)
+		return
+	}
+	defer lock.release()
+
+	if err := saveResourcePlan(stackName, req.Resources); err != nil {
+		logStackOpError(r, "resources", stackName, err)
+		http.Error(w, "cannot write resource plan", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resourcesResponse{Stack: stackName, Resources: req.Resources})
+	logStackOp(r, "resources", stackName)
+}
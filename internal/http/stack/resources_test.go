@@ -0,0 +1,52 @@
+package stack
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStackResourcesPlan(t *testing.T) {
+	_, stackPath := newTestStack(t, "game", map[string]string{"app": "nginx"})
+
+	w := serve(StackResourcesHandler, http.MethodPut, "/stack/resources", `{"stack":"game","resources":{"memory_mb":512}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("put: %d %s", w.Code, w.Body)
+	}
+	if _, err := os.Stat(resourcePlanPath("game")); err != nil {
+		t.Fatalf("plan not stored: %v", err)
+	}
+	if strings.HasPrefix(resourcePlanPath("game"), stackPath) {
+		t.Errorf("plan %s is inside the stack directory", resourcePlanPath("game"))
+	}
+	if _, err := os.Stat(resourceOverridePath("game")); !os.IsNotExist(err) {
+		t.Errorf("override written before any compose command: %v", err)
+	}
+
+	w = serve(StackResourcesHandler, http.MethodGet, "/stack/resources?stack=game", "")
+	var resp resourcesResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Resources == nil || resp.Resources.MemoryMB != 512 {
+		t.Fatalf("get: %d %+v %v", w.Code, resp.Resources, err)
+	}
+
+	if w := serve(StackUpHandler, http.MethodPost, "/stack/up", `{"stack":"game"}`); w.Code != http.StatusOK {
+		t.Fatalf("up: %d %s", w.Code, w.Body)
+	}
+	data, err := os.ReadFile(resourceOverridePath("game"))
+	if err != nil {
+		t.Fatalf("override after up: %v", err)
+	}
+	if !strings.Contains(string(data), `"mem_limit": "512m"`) {
+		t.Errorf("override = %s", data)
+	}
+
+	w = serve(StackResourcesHandler, http.MethodPut, "/stack/resources", `{"stack":"game","resources":{}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("clear: %d %s", w.Code, w.Body)
+	}
+	if _, err := os.Stat(resourcePlanPath("game")); !os.IsNotExist(err) {
+		t.Errorf("plan left after clearing: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package stack
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"vestri-worker/internal/backend"
+)
+
+const (
+	defaultStatsInterval = 5 * time.Second
+	minStatsInterval     = time.Second
+	maxStatsInterval     = 5 * time.Minute
+)
+
+type stackStats struct {
+	Stack      string                   `json:"stack"`
+	Read       time.Time                `json:"read"`
+	Containers []backend.ContainerStats `json:"containers"`
+}
+
+func StackStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req stackRequest
+	stackPath, err := parseStackName(r, &req)
+	if err != nil {
+		logStackOpError(r, "stats", "", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	query := r.URL.Query()
+	services, err := parseServices(query["service"])
+	if err != nil {
+		logStackOpError(r, "stats", stackName, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	interval, err := parseStatsInterval(query.Get("interval"))
+	if err != nil {
+		logStackOpError(r, "stats", stackName, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mode, err := streamMode(r, query.Get("stream"))
+	if err != nil {
+		logStackOpError(r, "stats", stackName, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rt, project, err := openStack(stackPath)
+	if err != nil {
+		logStackOpError(r, "stats", stackName, err)
+		http.Error(w, err.Error(), openStackStatus(err))
+		return
+	}
+
+	if mode == "" {
+		ctx, cancel := context.WithTimeout(r.Context(), composeTimeout)
+		defer cancel()
+
+		stats, err := sampleStats(ctx, rt, project, stackName, services)
+		if err != nil {
+			logStackOpError(r, "stats", stackName, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, stats)
+		logStackOp(r, "stats", stackName)
+		return
+	}
+
+	stream, err := newStreamWriter(w, mode)
+	if err != nil {
+		logStackOpError(r, "stats", stackName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logStackOp(r, "stats", stackName)
+
+	ctx := r.Context()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		stats, err := sampleStats(ctx, rt, project, stackName, services)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logStackOpError(r, "stats", stackName, err)
+			stream.Close(err)
+			return
+		}
+		if err := stream.Event("stats", stats); err != nil {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func sampleStats(ctx context.Context, rt backend.Backend, project backend.Project, stackName string, services []string) (stackStats, error) {
+	containers, err := rt.Stats(ctx, project, services)
+	if err != nil {
+		return stackStats{}, err
+	}
+	if containers == nil {
+		containers = []backend.ContainerStats{}
+	}
+	return stackStats{Stack: stackName, Read: time.Now().UTC(), Containers: containers}, nil
+}
+
+func parseStatsInterval(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultStatsInterval, nil
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(value)
+		if convErr != nil {
+			return 0, fmt.Errorf("invalid interval")
+		}
+		interval = time.Duration(seconds) * time.Second
+	}
+	if interval < minStatsInterval || interval > maxStatsInterval {
+		return 0, fmt.Errorf("interval must be between %s and %s", minStatsInterval, maxStatsInterval)
+	}
+	return interval, nil
+}
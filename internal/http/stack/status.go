@@ -0,0 +1,127 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"vestri-worker/internal/backend"
+)
+
+const (
+	stateRunning = "running"
+	statePartial = "partial"
+	stateStopped = "stopped"
+	stateMissing = "missing"
+)
+
+type serviceStatus struct {
+	ID        string         `json:"id"`
+	Container string         `json:"container"`
+	Service   string         `json:"service"`
+	State     string         `json:"state"`
+	Health    string         `json:"health,omitempty"`
+	ExitCode  int            `json:"exit_code"`
+	Status    string         `json:"status"`
+	Image     string         `json:"image"`
+	Ports     []backend.Port `json:"ports"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	StartedAt *time.Time     `json:"started_at,omitempty"`
+}
+
+type stackStatus struct {
+	Stack      string          `json:"stack"`
+	State      string          `json:"state"`
+	Containers []serviceStatus `json:"containers"`
+	Missing    []string        `json:"missing_services,omitempty"`
+	Lock       *lockHolder     `json:"lock,omitempty"`
+	Resources  *stackResources `json:"resources,omitempty"`
+}
+
+func loadStackStatus(ctx context.Context, stackPath, stackName string) (stackStatus, error) {
+	status := stackStatus{Stack: stackName, Containers: []serviceStatus{}}
+	if holder, ok := stackLocks.holder(stackName); ok {
+		status.Lock = &holder
+	}
+
+	project, err := stackProject(stackPath)
+	if err != nil && !errors.Is(err, errNoComposeFile) {
+		return status, err
+	}
+	hasFiles := err == nil
+
+	rt, err := backend.Default()
+	if err != nil {
+		return status, err
+	}
+
+	containers, err := rt.Containers(ctx, project)
+	if err != nil {
+		return status, err
+	}
+	for _, c := range containers {
+		status.Containers = append(status.Containers, serviceStatus{
+			ID:        c.ID,
+			Container: c.Name,
+			Service:   c.Service,
+			State:     c.State,
+			Health:    c.Health,
+			ExitCode:  c.ExitCode,
+			Status:    c.Status,
+			Image:     c.Image,
+			Ports:     c.Ports,
+			CreatedAt: c.CreatedAt,
+			StartedAt: c.StartedAt,
+		})
+	}
+
+	var services []string
+	if hasFiles {
+		project = withResourceOverride(project)
+		if config, err := loadComposeConfig(ctx, rt, project); err == nil {
+			for name := range config.Services {
+				services = append(services, name)
+			}
+			sort.Strings(services)
+			status.Resources = &stackResources{Services: effectiveLimits(config)}
+			if plan, err := loadResourcePlan(stackName); err == nil {
+				status.Resources.Plan = plan
+			}
+		}
+	}
+	status.State, status.Missing = aggregateState(status.Containers, services)
+	return status, nil
+}
+
+func aggregateState(containers []serviceStatus, services []string) (string, []string) {
+	if len(containers) == 0 {
+		return stateMissing, services
+	}
+
+	running := make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, c := range containers {
+		seen[c.Service] = true
+		if c.State == "running" {
+			running[c.Service] = true
+		}
+	}
+
+	var missing []string
+	for _, service := range services {
+		if !seen[service] {
+			missing = append(missing, service)
+			seen[service] = true
+		}
+	}
+
+	switch {
+	case len(running) == 0:
+		return stateStopped, missing
+	case len(running) == len(seen):
+		return stateRunning, missing
+	default:
+		return statePartial, missing
+	}
+}
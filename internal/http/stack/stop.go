@@ -0,0 +1,199 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"vestri-worker/internal/backend"
+	"vestri-worker/internal/settings"
+)
+
+const (
+	preStopConsole = "console"
+	preStopRcon    = "rcon"
+	preStopExec    = "exec"
+
+	// Hook, wait and stop timeout together must fit within composeTimeout.
+	preStopTimeout = 30 * time.Second
+	maxStopWait    = 2 * time.Minute
+	maxStopTimeout = 2 * time.Minute
+)
+
+type stopRequest struct {
+	actionRequest
+	servicesRequest
+	SkipPreStop bool `json:"skip_pre_stop"`
+}
+
+// stopPolicy is the validated form of the stack's stop metadata.
+type stopPolicy struct {
+	stackPath string
+	stackName string
+	preStop   *preStopMeta
+	wait      time.Duration
+	timeout   int
+}
+
+func loadStopPolicy(stackPath, stackName string) (stopPolicy, error) {
+	policy := stopPolicy{stackPath: stackPath, stackName: stackName}
+
+	meta, err := loadStackMeta(stackPath)
+	if err != nil {
+		return policy, fmt.Errorf("invalid stack metadata: %w", err)
+	}
+	if meta.Stop == nil {
+		return policy, nil
+	}
+
+	stop := meta.Stop
+	if err := stop.validate(); err != nil {
+		return policy, err
+	}
+	policy.wait = time.Duration(stop.WaitSeconds) * time.Second
+	policy.timeout = stop.TimeoutSeconds
+	policy.preStop = stop.PreStop
+	return policy, nil
+}
+
+func (stop *stopMeta) validate() error {
+	if stop.WaitSeconds < 0 || time.Duration(stop.WaitSeconds)*time.Second > maxStopWait {
+		return fmt.Errorf("invalid stop wait_seconds %d", stop.WaitSeconds)
+	}
+	if stop.TimeoutSeconds < 0 || time.Duration(stop.TimeoutSeconds)*time.Second > maxStopTimeout {
+		return fmt.Errorf("invalid stop timeout_seconds %d", stop.TimeoutSeconds)
+	}
+
+	if pre := stop.PreStop; pre != nil {
+		if strings.TrimSpace(pre.Command) == "" {
+			return fmt.Errorf("pre_stop command is required")
+		}
+		switch pre.Type {
+		case preStopRcon:
+		case preStopConsole, preStopExec:
+			if !validService.MatchString(pre.Service) {
+				return fmt.Errorf("pre_stop service is required for %s", pre.Type)
+			}
+		default:
+			return fmt.Errorf("invalid pre_stop type %q", pre.Type)
+		}
+	}
+	return nil
+}
+
+// down runs the pre-stop hook and wait, then compose down with the policy's
+// stop timeout.
+func (p stopPolicy) down(ctx context.Context, rt backend.Backend, project backend.Project, opts backend.DownOptions, skipPreStop bool, out io.Writer) error {
+	if err := p.beforeStop(ctx, rt, project, opts.Services, skipPreStop, out); err != nil {
+		return err
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = p.timeout
+	}
+	return rt.Down(ctx, project, opts, out)
+}
+
+// beforeStop runs the pre-stop hook when the services about to stop include
+// the hook's service; an RCON hook only runs when the whole stack stops. A
+// failing hook is reported but does not prevent the stop.
+func (p stopPolicy) beforeStop(ctx context.Context, rt backend.Backend, project backend.Project, services []string, skipPreStop bool, out io.Writer) error {
+	if p.preStop == nil || skipPreStop {
+		return nil
+	}
+	if len(services) > 0 && !slices.Contains(services, p.preStop.Service) {
+		return nil
+	}
+
+	if err := p.runPreStop(ctx, rt, project, out); err != nil {
+		fmt.Fprintf(out, "pre-stop failed: %v\n", err)
+	}
+	return ctx.Err()
+}
+
+func (p stopPolicy) runPreStop(ctx context.Context, rt backend.Backend, project backend.Project, out io.Writer) error {
+	pre := p.preStop
+
+	if pre.Type != preStopRcon {
+		running, err := serviceRunning(ctx, rt, project, pre.Service)
+		if err != nil {
+			return err
+		}
+		if !running {
+			fmt.Fprintf(out, "pre-stop skipped: service %s is not running\n", pre.Service)
+			return nil
+		}
+	}
+
+	hookCtx, cancel := context.WithTimeout(ctx, preStopTimeout)
+	defer cancel()
+
+	fmt.Fprintf(out, "pre-stop %s: %s\n", pre.Type, pre.Command)
+	switch pre.Type {
+	case preStopRcon:
+		response, err := rconCommand(hookCtx, p.stackPath, p.stackName, pre.Command)
+		if err != nil {
+			return err
+		}
+		if response = strings.TrimSpace(response); response != "" {
+			fmt.Fprintln(out, response)
+		}
+	case preStopConsole:
+		if err := consoleCommand(hookCtx, rt, project, pre.Service, pre.Command); err != nil {
+			return err
+		}
+	case preStopExec:
+		command := strings.Fields(pre.Command)
+		if !commandAllowed(command, settings.Get().ExecAllowedCommands) {
+			return errCommandNotAllowed
+		}
+		code, err := rt.Exec(hookCtx, project, backend.ExecOptions{Service: pre.Service, Command: command}, out, out)
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return fmt.Errorf("exit code %d", code)
+		}
+	}
+
+	if p.wait > 0 {
+		fmt.Fprintf(out, "waiting %s before stopping\n", p.wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.wait):
+		}
+	}
+	return nil
+}
+
+// consoleCommand types a line into the service console.
+func consoleCommand(ctx context.Context, rt backend.Backend, project backend.Project, service, command string) error {
+	console, err := rt.Attach(ctx, project, service)
+	if err != nil {
+		return err
+	}
+	defer console.Close()
+
+	if !console.Writable() {
+		return errors.New("console stdin is not open")
+	}
+	_, err = io.WriteString(console, command+"\n")
+	return err
+}
+
+func serviceRunning(ctx context.Context, rt backend.Backend, project backend.Project, service string) (bool, error) {
+	containers, err := rt.Containers(ctx, project)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range containers {
+		if c.Service == service && c.State == "running" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
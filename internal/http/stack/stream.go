@@ -0,0 +1,187 @@
+package stack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	streamText = "text"
+	streamSSE  = "sse"
+
+	trailerExitCode  = "X-Exit-Code"
+	trailerExitError = "X-Exit-Error"
+)
+
+type exitEvent struct {
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+// streamWriter forwards process output to the client line by line, either as
+// chunked plain text or as Server-Sent Events. Once the client is gone the
+// output is discarded instead of failing the writer, so the process is not
+// killed by a broken pipe halfway through.
+type streamWriter struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	mode    string
+	partial []byte
+	err     error
+}
+
+func streamMode(r *http.Request, requested string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(requested)) {
+	case "":
+		if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			return streamSSE, nil
+		}
+		return "", nil
+	case "false", "0":
+		return "", nil
+	case streamText, "true", "1", "chunked":
+		return streamText, nil
+	case streamSSE:
+		return streamSSE, nil
+	default:
+		return "", fmt.Errorf("invalid stream mode")
+	}
+}
+
+func newStreamWriter(w http.ResponseWriter, mode string) (*streamWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming not supported")
+	}
+
+	header := w.Header()
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	if mode == streamSSE {
+		header.Set("Content-Type", "text/event-stream")
+	} else {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("Trailer", trailerExitCode+", "+trailerExitError)
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &streamWriter{w: w, flusher: flusher, mode: mode}, nil
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return len(p), nil
+	}
+	s.partial = append(s.partial, p...)
+	for {
+		idx := bytes.IndexByte(s.partial, '\n')
+		if idx < 0 {
+			break
+		}
+		line := bytes.TrimSuffix(s.partial[:idx], []byte("\r"))
+		if err := s.writeLine(line); err != nil {
+			s.err = err
+			s.partial = nil
+			return len(p), nil
+		}
+		s.partial = s.partial[idx+1:]
+	}
+	s.flusher.Flush()
+	return len(p), nil
+}
+
+// Err returns the first error writing to the client, if any.
+func (s *streamWriter) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *streamWriter) writeLine(line []byte) error {
+	var err error
+	if s.mode == streamSSE {
+		_, err = fmt.Fprintf(s.w, "event: output\ndata: %s\n\n", line)
+	} else {
+		_, err = fmt.Fprintf(s.w, "%s\n", line)
+	}
+	return err
+}
+
+func (s *streamWriter) Result(v any) {
+	s.Event("result", v)
+}
+
+// Event writes v as a JSON document: a named event in SSE mode, a single line
+// otherwise.
+func (s *streamWriter) Event(name string, v any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.partial) > 0 {
+		_ = s.writeLine(s.partial)
+		s.partial = nil
+	}
+
+	return s.writeEvent(name, v)
+}
+
+func (s *streamWriter) writeEvent(name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if s.mode == streamSSE {
+		_, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", name, data)
+	} else {
+		_, err = fmt.Fprintf(s.w, "%s\n", data)
+	}
+	s.flusher.Flush()
+	return err
+}
+
+// Close ends the stream with an exit event carrying the exit status. Text
+// streams also set it as trailers for clients that read them.
+func (s *streamWriter) Close(runErr error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.partial) > 0 {
+		_ = s.writeLine(s.partial)
+		s.partial = nil
+	}
+
+	event := exitEvent{ExitCode: exitCode(runErr)}
+	if runErr != nil {
+		event.Error = runErr.Error()
+	}
+
+	if s.mode != streamSSE {
+		s.w.Header().Set(trailerExitCode, strconv.Itoa(event.ExitCode))
+		s.w.Header().Set(trailerExitError, event.Error)
+	}
+	_ = s.writeEvent("exit", event)
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
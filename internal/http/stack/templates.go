@@ -0,0 +1,200 @@
+package stack
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"vestri-worker/internal/settings"
+	"vestri-worker/internal/templates"
+)
+
+// Templates live next to the stacks; the leading dot keeps them out of
+// /stack/list while /fs endpoints can still upload and edit them.
+const templatesDir = ".templates"
+
+type createRequest struct {
+	stackRequest
+	Template  string            `json:"template"`
+	Variables map[string]string `json:"variables"`
+}
+
+type createResponse struct {
+	Stack     string            `json:"stack"`
+	Template  string            `json:"template"`
+	Variables map[string]string `json:"variables"`
+	Generated map[string]string `json:"generated,omitempty"`
+}
+
+type templateErrorResponse struct {
+	Error  string                    `json:"error"`
+	Errors []templates.VariableError `json:"errors"`
+}
+
+func templatesPath() string {
+	return filepath.Join(settings.Get().FsBasePath, templatesDir)
+}
+
+func StackTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if name := r.URL.Query().Get("name"); name != "" {
+		t, err := templates.Load(templatesPath(), name)
+		if err != nil {
+			logStackOpError(r, "templates", "", err)
+			http.Error(w, err.Error(), templateErrorStatus(err))
+			return
+		}
+		writeJSON(w, http.StatusOK, t)
+		logStackOp(r, "templates", "")
+		return
+	}
+
+	list, err := templates.List(templatesPath())
+	if err != nil {
+		logStackOpError(r, "templates", "", err)
+		http.Error(w, "cannot read templates directory", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+	logStackOp(r, "templates", "")
+}
+
+func StackCreateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req createRequest
+	stackPath, err := resolveStackName(r, &req)
+	if err != nil {
+		logStackOpError(r, "create", "", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	t, err := templates.Load(templatesPath(), req.Template)
+	if err != nil {
+		logStackOpError(r, "create", stackName, err)
+		http.Error(w, err.Error(), templateErrorStatus(err))
+		return
+	}
+
+	values, generated, err := t.Resolve(req.Variables)
+	if err != nil {
+		logStackOpError(r, "create", stackName, err)
+		var invalid *templates.ValidationError
+		if errors.As(err, &invalid) {
+			writeJSON(w, http.StatusUnprocessableEntity, templateErrorResponse{Error: "invalid variables", Errors: invalid.Errors})
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	lock, conflict := lockStack(r, stackName, "create", false)
+	if conflict != nil {
+		logStackOpError(r, "create", stackName, conflict)
+		writeConflict(w, conflict)
+		return
+	}
+	defer lock.release()
+
+	if _, err := os.Lstat(stackPath); err == nil {
+		logStackOpError(r, "create", stackName, fmt.Errorf("stack already exists"))
+		http.Error(w, "stack already exists", http.StatusConflict)
+		return
+	}
+
+	if err := createStack(stackPath, t, values); err != nil {
+		logStackOpError(r, "create", stackName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Generated secrets are returned once; every secret is masked in
+	// variables, as it is in /stack/env.
+	resp := createResponse{
+		Stack:     stackName,
+		Template:  t.Name,
+		Variables: make(map[string]string, len(values)),
+	}
+	for name, value := range values {
+		resp.Variables[name] = value
+	}
+	for _, name := range t.Secrets() {
+		resp.Variables[name] = maskedValue
+	}
+	if len(generated) > 0 {
+		resp.Generated = make(map[string]string, len(generated))
+		for _, name := range generated {
+			resp.Generated[name] = values[name]
+		}
+	}
+
+	writeJSON(w, http.StatusCreated, resp)
+	logStackOp(r, "create", stackName)
+}
+
+// createStack renders the template into a temporary directory next to the
+// stack and renames it into place, so a failed create leaves nothing behind.
+func createStack(stackPath string, t *templates.Template, values map[string]string) error {
+	base := filepath.Dir(stackPath)
+	if err := os.MkdirAll(base, 0755); err != nil {
+		return fmt.Errorf("failed to create base directory: %w", err)
+	}
+	tmp, err := os.MkdirTemp(base, ".create-"+filepath.Base(stackPath)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return err
+	}
+	data := templates.RenderData{Stack: filepath.Base(stackPath), Vars: values}
+	if err := t.Instantiate(tmp, data); err != nil {
+		return fmt.Errorf("template: %w", err)
+	}
+
+	env, err := loadEnvFile(tmp)
+	if err != nil {
+		return fmt.Errorf("env: %w", err)
+	}
+	for _, v := range t.Variables {
+		env.Set(v.Name, values[v.Name])
+	}
+	if err := env.Save(tmp); err != nil {
+		return fmt.Errorf("env: %w", err)
+	}
+
+	meta, err := loadStackMeta(tmp)
+	if err != nil {
+		return fmt.Errorf("metadata: %w", err)
+	}
+	meta.Template = t.Name
+	meta.SecretEnv = mergeKeys(meta.SecretEnv, t.Secrets())
+	if err := saveStackMeta(tmp, meta); err != nil {
+		return fmt.Errorf("metadata: %w", err)
+	}
+
+	if _, err := os.Lstat(stackPath); err == nil {
+		return fmt.Errorf("stack already exists")
+	}
+	return os.Rename(tmp, stackPath)
+}
+
+func templateErrorStatus(err error) int {
+	if errors.Is(err, templates.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,171 @@
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"vestri-worker/internal/backend"
+	"vestri-worker/internal/policy"
+	"vestri-worker/internal/settings"
+)
+
+var (
+	configFilePattern = regexp.MustCompile(`^(?:validating|parsing|open) ([^:]+): (.*)$`)
+	configLinePattern = regexp.MustCompile(`line (\d+)`)
+	configPathPattern = regexp.MustCompile(`^((?:services|networks|volumes|configs|secrets)(?:\.[^\s.:]+)*)`)
+	logPrefixPattern  = regexp.MustCompile(`^time="[^"]*" level=(\w+) msg="(.*)"$`)
+)
+
+type configIssue struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+type validationResult struct {
+	Stack    string             `json:"stack"`
+	Valid    bool               `json:"valid"`
+	Errors   []configIssue      `json:"errors,omitempty"`
+	Warnings []configIssue      `json:"warnings,omitempty"`
+	Policy   []policy.Violation `json:"policy_violations,omitempty"`
+	Services []string           `json:"services,omitempty"`
+}
+
+func validateStack(ctx context.Context, rt backend.Backend, project backend.Project) (validationResult, error) {
+	result := validationResult{Stack: project.Name}
+
+	config, diagnostics, err := rt.Config(ctx, project)
+
+	var configErr *backend.ConfigError
+	if err != nil && !errors.As(err, &configErr) {
+		return result, err
+	}
+
+	result.Errors, result.Warnings = parseConfigIssues(diagnostics)
+	if err != nil {
+		if len(result.Errors) == 0 {
+			result.Errors = []configIssue{{Message: err.Error()}}
+		}
+		return result, nil
+	}
+
+	// The normalized config carries interpolated .env values, secrets
+	// included, so only the service names are returned.
+	result.Errors = nil
+	var parsed struct {
+		Services map[string]json.RawMessage `json:"services"`
+	}
+	if err := json.Unmarshal(config, &parsed); err != nil {
+		return result, err
+	}
+	for name := range parsed.Services {
+		result.Services = append(result.Services, name)
+	}
+	sort.Strings(result.Services)
+
+	if s := settings.Get(); s.PolicyEnabled {
+		result.Policy, err = policy.Check(config, project.Dir, policyRules(s))
+		if err != nil {
+			return result, err
+		}
+	}
+	result.Valid = len(result.Policy) == 0
+	return result, nil
+}
+
+func parseConfigIssues(stderr string) ([]configIssue, []configIssue) {
+	var errs, warnings []configIssue
+
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		warning := false
+		if match := logPrefixPattern.FindStringSubmatch(line); match != nil {
+			warning = match[1] == "warning"
+			line = strings.ReplaceAll(match[2], `\"`, `"`)
+		} else if strings.HasPrefix(line, "WARN") {
+			warning = true
+			if idx := strings.Index(line, "]"); idx >= 0 {
+				line = strings.TrimSpace(line[idx+1:])
+			}
+		}
+
+		issue := parseConfigIssue(line)
+		if warning {
+			warnings = append(warnings, issue)
+		} else {
+			errs = append(errs, issue)
+		}
+	}
+	return errs, warnings
+}
+
+func parseConfigIssue(line string) configIssue {
+	issue := configIssue{Message: line}
+
+	message := line
+	if match := configFilePattern.FindStringSubmatch(line); match != nil {
+		issue.File = filepath.Base(match[1])
+		message = match[2]
+	}
+	if match := configLinePattern.FindStringSubmatch(message); match != nil {
+		issue.Line, _ = strconv.Atoi(match[1])
+	}
+	if match := configPathPattern.FindStringSubmatch(message); match != nil {
+		issue.Path = match[1]
+	}
+	if idx := strings.Index(message, "interpolating "); idx >= 0 {
+		if match := configPathPattern.FindStringSubmatch(message[idx+len("interpolating "):]); match != nil {
+			issue.Path = match[1]
+		}
+	}
+	issue.Message = message
+	return issue
+}
+
+func StackValidateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req stackRequest
+	stackPath, err := parseExistingStack(r, &req)
+	if err != nil {
+		logStackOpError(r, "validate", "", err)
+		http.Error(w, err.Error(), stackErrorStatus(err))
+		return
+	}
+	stackName := filepath.Base(stackPath)
+
+	rt, project, err := openStack(stackPath)
+	if err != nil {
+		logStackOpError(r, "validate", stackName, err)
+		http.Error(w, err.Error(), openStackStatus(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), composeTimeout)
+	defer cancel()
+
+	result, err := validateStack(ctx, rt, project)
+	if err != nil {
+		logStackOpError(r, "validate", stackName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+	logStackOp(r, "validate", stackName)
+}
@@ -0,0 +1,349 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	"vestri-worker/internal/settings"
+)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCanceled  Status = "canceled"
+)
+
+const (
+	defaultMaxJobs  = 4
+	maxOutputBytes  = 1 << 20
+	finishedJobTTL  = time.Hour
+	maxFinishedJobs = 1000
+)
+
+var (
+	ErrNotFound = errors.New("job not found")
+	ErrFinished = errors.New("job already finished")
+)
+
+type Func func(ctx context.Context, out io.Writer) error
+
+type ResultFunc func(ctx context.Context, out io.Writer) (any, error)
+
+// WaitFunc runs before a queued job takes a worker slot, so that jobs waiting
+// on something else, such as a stack lock, do not hold one. The returned func
+// is called when the job's work is done, before it is marked finished.
+type WaitFunc func(ctx context.Context) (func(), error)
+
+type Job struct {
+	ID         string     `json:"id"`
+	Action     string     `json:"action"`
+	Stack      string     `json:"stack"`
+	Status     Status     `json:"status"`
+	ExitCode   *int       `json:"exit_code,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Output     string     `json:"output,omitempty"`
+	Result     any        `json:"result,omitempty"`
+	Truncated  bool       `json:"output_truncated,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+func (j Job) Finished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed || j.Status == StatusCanceled
+}
+
+type entry struct {
+	job      Job
+	output   outputBuffer
+	cancel   context.CancelFunc
+	canceled bool
+	done     chan struct{}
+}
+
+type Manager struct {
+	mu          sync.Mutex
+	slots       chan struct{}
+	jobs        map[string]*entry
+	order       []string
+	lastCleanup time.Time
+}
+
+var (
+	defaultManager *Manager
+	defaultOnce    sync.Once
+)
+
+func Default() *Manager {
+	defaultOnce.Do(func() {
+		defaultManager = NewManager(maxJobs())
+	})
+	return defaultManager
+}
+
+func maxJobs() int {
+	if v := settings.Get().MaxJobs; v > 0 {
+		return v
+	}
+	return defaultMaxJobs
+}
+
+func NewManager(workers int) *Manager {
+	if workers <= 0 {
+		workers = defaultMaxJobs
+	}
+	return &Manager{
+		slots: make(chan struct{}, workers),
+		jobs:  make(map[string]*entry),
+	}
+}
+
+func (m *Manager) Submit(action, stack string, fn Func) (Job, error) {
+	return m.SubmitResult(action, stack, func(ctx context.Context, out io.Writer) (any, error) {
+		return nil, fn(ctx, out)
+	})
+}
+
+func (m *Manager) SubmitResult(action, stack string, fn ResultFunc) (Job, error) {
+	return m.SubmitAfter(action, stack, nil, fn)
+}
+
+// SubmitAfter queues fn to run once wait, if not nil, has returned.
+func (m *Manager) SubmitAfter(action, stack string, wait WaitFunc, fn ResultFunc) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	now := time.Now()
+	e := &entry{
+		job: Job{
+			ID:        id,
+			Action:    action,
+			Stack:     stack,
+			Status:    StatusQueued,
+			CreatedAt: now,
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	m.jobs[id] = e
+	m.order = append(m.order, id)
+	m.cleanupIfNeeded(now)
+	job := e.job
+	m.mu.Unlock()
+
+	go m.run(ctx, e, wait, fn)
+	return job, nil
+}
+
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	job := e.job
+	job.Output, job.Truncated = e.output.snapshot()
+	return job, nil
+}
+
+func (m *Manager) List() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]Job, 0, len(m.order))
+	for _, id := range m.order {
+		if e, ok := m.jobs[id]; ok {
+			result = append(result, e.job)
+		}
+	}
+	return result
+}
+
+func (m *Manager) Done(id string) (<-chan struct{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return e.done, nil
+}
+
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	if e.job.Finished() {
+		return e.job, ErrFinished
+	}
+	e.canceled = true
+	e.cancel()
+	return e.job, nil
+}
+
+// Acquire takes a worker slot for work that runs outside the queue, so that
+// synchronous actions count against max_jobs too. The returned func frees it.
+func (m *Manager) Acquire(ctx context.Context) (func(), error) {
+	select {
+	case m.slots <- struct{}{}:
+		return func() { <-m.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (m *Manager) run(ctx context.Context, e *entry, wait WaitFunc, fn ResultFunc) {
+	defer e.cancel()
+
+	release := func() {}
+	if wait != nil {
+		var err error
+		if release, err = wait(ctx); err != nil {
+			m.finish(e, nil, err)
+			return
+		}
+	}
+
+	result, err := m.runInSlot(ctx, e, fn)
+	release()
+	m.finish(e, result, err)
+}
+
+func (m *Manager) runInSlot(ctx context.Context, e *entry, fn ResultFunc) (any, error) {
+	select {
+	case m.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-m.slots }()
+
+	m.mu.Lock()
+	if e.canceled {
+		m.mu.Unlock()
+		return nil, context.Canceled
+	}
+	started := time.Now()
+	e.job.Status = StatusRunning
+	e.job.StartedAt = &started
+	m.mu.Unlock()
+
+	return fn(ctx, &e.output)
+}
+
+func (m *Manager) finish(e *entry, result any, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	finished := time.Now()
+	e.job.FinishedAt = &finished
+	e.job.Result = result
+	defer close(e.done)
+
+	var exitErr *exec.ExitError
+	switch {
+	case e.canceled:
+		e.job.Status = StatusCanceled
+	case err != nil:
+		e.job.Status = StatusFailed
+	default:
+		e.job.Status = StatusSucceeded
+	}
+	if err != nil {
+		e.job.Error = err.Error()
+	}
+	if errors.As(err, &exitErr) {
+		code := exitErr.ExitCode()
+		e.job.ExitCode = &code
+	} else if err == nil {
+		code := 0
+		e.job.ExitCode = &code
+	}
+}
+
+func (m *Manager) cleanupIfNeeded(now time.Time) {
+	if now.Sub(m.lastCleanup) < time.Minute && len(m.order) <= maxFinishedJobs {
+		return
+	}
+
+	cutoff := now.Add(-finishedJobTTL)
+	finished := 0
+	for _, id := range m.order {
+		if m.jobs[id].job.Finished() {
+			finished++
+		}
+	}
+
+	kept := m.order[:0]
+	for _, id := range m.order {
+		e := m.jobs[id]
+		if e.job.Finished() && (e.job.FinishedAt.Before(cutoff) || finished > maxFinishedJobs) {
+			delete(m.jobs, id)
+			finished--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	m.order = kept
+	m.lastCleanup = now
+}
+
+type outputBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	remaining := maxOutputBytes - b.buf.Len()
+	if remaining <= 0 {
+		b.truncated = true
+		return len(p), nil
+	}
+	if len(p) > remaining {
+		b.buf.Write(p[:remaining])
+		b.truncated = true
+		return len(p), nil
+	}
+	b.buf.Write(p)
+	return len(p), nil
+}
+
+func (b *outputBuffer) snapshot() (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String(), b.truncated
+}
+
+func newID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,449 @@
+// Package policy checks a resolved compose configuration, as printed by
+// "compose config --format json", against the features a stack may use.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	RulePrivileged         = "privileged"
+	RuleCapAdd             = "cap_add"
+	RuleHostNetwork        = "host_network"
+	RuleHostPID            = "host_pid"
+	RuleHostIPC            = "host_ipc"
+	RuleDevices            = "devices"
+	RuleBindMount          = "bind_mount"
+	RuleUnconfined         = "unconfined"
+	RuleHostUserns         = "host_userns"
+	RuleHostCgroup         = "host_cgroup"
+	RuleCgroupParent       = "cgroup_parent"
+	RuleHostUTS            = "host_uts"
+	RuleContainerNamespace = "container_namespace"
+	RuleVolumesFrom        = "volumes_from"
+	RuleExternalVolume     = "external_volume"
+	RuleBuildContext       = "build_context"
+	RuleEnvFile            = "env_file"
+)
+
+// Rules lists what is allowed; the zero value forbids everything the
+// package checks for.
+type Rules struct {
+	AllowPrivileged     bool
+	AllowedCapabilities []string
+	AllowHostNetwork    bool
+	AllowHostPID        bool
+	AllowHostIPC        bool
+	AllowDevices        bool
+	// AllowUnconfined permits security_opt entries that switch off seccomp,
+	// AppArmor, SELinux labels or the masked /proc and /sys paths.
+	AllowUnconfined   bool
+	AllowHostUserns   bool
+	AllowHostCgroup   bool
+	AllowCgroupParent bool
+	AllowHostUTS      bool
+	// AllowContainerNS permits joining the network, pid or ipc namespace of
+	// a container by name with "container:<name>".
+	AllowContainerNS bool
+	// AllowVolumesFrom permits volumes_from entries naming a container rather
+	// than a service of the same project.
+	AllowVolumesFrom bool
+	AllowExtVolumes  bool
+	// AllowedBindPaths are host paths, besides the stack directory, that may
+	// be bind mounted together with everything below them.
+	AllowedBindPaths []string
+}
+
+type Violation struct {
+	Rule    string `json:"rule"`
+	Service string `json:"service,omitempty"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Path + ": " + v.Message
+	}
+	return "compose policy violation: " + strings.Join(messages, "; ")
+}
+
+type config struct {
+	Services map[string]service `json:"services"`
+	Volumes  map[string]struct {
+		DriverOpts map[string]string `json:"driver_opts"`
+		External   externalFlag      `json:"external"`
+	} `json:"volumes"`
+	Configs map[string]fileObject `json:"configs"`
+	Secrets map[string]fileObject `json:"secrets"`
+}
+
+type service struct {
+	Privileged   bool              `json:"privileged"`
+	CapAdd       []string          `json:"cap_add"`
+	NetworkMode  string            `json:"network_mode"`
+	Pid          string            `json:"pid"`
+	Ipc          string            `json:"ipc"`
+	Devices      []json.RawMessage `json:"devices"`
+	Volumes      []json.RawMessage `json:"volumes"`
+	SecurityOpt  []string          `json:"security_opt"`
+	UsernsMode   string            `json:"userns_mode"`
+	Cgroup       string            `json:"cgroup"`
+	CgroupParent string            `json:"cgroup_parent"`
+	Uts          string            `json:"uts"`
+	VolumesFrom  []string          `json:"volumes_from"`
+	Build        *buildConfig      `json:"build"`
+	EnvFile      []envFile         `json:"env_file"`
+}
+
+type buildConfig struct {
+	Context            string            `json:"context"`
+	Dockerfile         string            `json:"dockerfile"`
+	AdditionalContexts map[string]string `json:"additional_contexts"`
+}
+
+// envFile accepts the object form newer compose releases print and a plain
+// path.
+type envFile struct {
+	Path string `json:"path"`
+}
+
+func (f *envFile) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &f.Path); err == nil {
+		return nil
+	}
+	var obj struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	f.Path = obj.Path
+	return nil
+}
+
+// externalFlag accepts external as compose config prints it, a bool, and the
+// legacy object form naming the volume.
+type externalFlag bool
+
+func (f *externalFlag) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*f = externalFlag(b)
+		return nil
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*f = obj != nil
+	return nil
+}
+
+type fileObject struct {
+	File string `json:"file"`
+}
+
+type volumeMount struct {
+	Type   string `json:"type"`
+	Source string `json:"source"`
+}
+
+// Check returns the violations found in config for a stack living in
+// stackDir. Violations are sorted by path.
+func Check(data []byte, stackDir string, rules Rules) ([]Violation, error) {
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid compose config: %w", err)
+	}
+
+	c := checker{
+		rules:     rules,
+		roots:     bindRoots(stackDir, rules.AllowedBindPaths),
+		stackRoot: bindRoots(stackDir, nil),
+	}
+	for name, svc := range cfg.Services {
+		c.service(name, svc, stackDir)
+	}
+	for name, volume := range cfg.Volumes {
+		// The local driver can bind any host path through driver_opts.
+		if device := volume.DriverOpts["device"]; device != "" && strings.Contains(volume.DriverOpts["o"], "bind") {
+			c.bindSource("", "volumes."+name+".driver_opts.device", device, stackDir)
+		}
+		if bool(volume.External) && !rules.AllowExtVolumes {
+			c.add(RuleExternalVolume, "", "volumes."+name+".external", "external volumes are not allowed")
+		}
+	}
+	for name, obj := range cfg.Configs {
+		if obj.File != "" {
+			c.bindSource("", "configs."+name+".file", obj.File, stackDir)
+		}
+	}
+	for name, obj := range cfg.Secrets {
+		if obj.File != "" {
+			c.bindSource("", "secrets."+name+".file", obj.File, stackDir)
+		}
+	}
+
+	sort.Slice(c.violations, func(i, j int) bool { return c.violations[i].Path < c.violations[j].Path })
+	return c.violations, nil
+}
+
+type checker struct {
+	rules Rules
+	roots []string
+	// stackRoot bounds files the worker reads on the stack's behalf, which
+	// AllowedBindPaths does not extend.
+	stackRoot  []string
+	violations []Violation
+}
+
+func (c *checker) add(rule, service, path, message string) {
+	c.violations = append(c.violations, Violation{Rule: rule, Service: service, Path: path, Message: message})
+}
+
+func (c *checker) service(name string, svc service, stackDir string) {
+	prefix := "services." + name
+
+	if svc.Privileged && !c.rules.AllowPrivileged {
+		c.add(RulePrivileged, name, prefix+".privileged", "privileged mode is not allowed")
+	}
+	for _, capability := range svc.CapAdd {
+		if !capabilityAllowed(capability, c.rules.AllowedCapabilities) {
+			c.add(RuleCapAdd, name, prefix+".cap_add", fmt.Sprintf("capability %s is not allowed", capability))
+		}
+	}
+	if svc.NetworkMode == "host" && !c.rules.AllowHostNetwork {
+		c.add(RuleHostNetwork, name, prefix+".network_mode", "host networking is not allowed")
+	}
+	if svc.Pid == "host" && !c.rules.AllowHostPID {
+		c.add(RuleHostPID, name, prefix+".pid", "host pid namespace is not allowed")
+	}
+	if svc.Ipc == "host" && !c.rules.AllowHostIPC {
+		c.add(RuleHostIPC, name, prefix+".ipc", "host ipc namespace is not allowed")
+	}
+	if svc.UsernsMode == "host" && !c.rules.AllowHostUserns {
+		c.add(RuleHostUserns, name, prefix+".userns_mode", "host user namespace is not allowed")
+	}
+	if svc.Cgroup == "host" && !c.rules.AllowHostCgroup {
+		c.add(RuleHostCgroup, name, prefix+".cgroup", "host cgroup namespace is not allowed")
+	}
+	if svc.CgroupParent != "" && !c.rules.AllowCgroupParent {
+		c.add(RuleCgroupParent, name, prefix+".cgroup_parent", "cgroup_parent is not allowed")
+	}
+	if svc.Uts == "host" && !c.rules.AllowHostUTS {
+		c.add(RuleHostUTS, name, prefix+".uts", "host uts namespace is not allowed")
+	}
+	if !c.rules.AllowContainerNS {
+		for _, ns := range []struct{ field, value string }{
+			{"network_mode", svc.NetworkMode},
+			{"pid", svc.Pid},
+			{"ipc", svc.Ipc},
+		} {
+			if strings.HasPrefix(ns.value, "container:") {
+				c.add(RuleContainerNamespace, name, prefix+"."+ns.field, fmt.Sprintf("joining %s is not allowed", ns.value))
+			}
+		}
+	}
+	if len(svc.Devices) > 0 && !c.rules.AllowDevices {
+		c.add(RuleDevices, name, prefix+".devices", "device mappings are not allowed")
+	}
+	for _, opt := range svc.SecurityOpt {
+		if unconfined(opt) && !c.rules.AllowUnconfined {
+			c.add(RuleUnconfined, name, prefix+".security_opt", fmt.Sprintf("security option %s is not allowed", opt))
+		}
+	}
+	for _, source := range svc.VolumesFrom {
+		if strings.HasPrefix(source, "container:") && !c.rules.AllowVolumesFrom {
+			c.add(RuleVolumesFrom, name, prefix+".volumes_from", fmt.Sprintf("volumes from %s are not allowed", source))
+		}
+	}
+
+	for i, raw := range svc.Volumes {
+		mount, ok := parseVolume(raw)
+		if !ok || mount.Type != "bind" {
+			continue
+		}
+		c.bindSource(name, fmt.Sprintf("%s.volumes[%d]", prefix, i), mount.Source, stackDir)
+	}
+
+	// Build contexts and env files are read by compose on the host, so they
+	// must stay inside the stack directory like bind mounts.
+	if build := svc.Build; build != nil {
+		if !remoteContext(build.Context) {
+			dir := build.Context
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(stackDir, dir)
+			}
+			c.stackFile(RuleBuildContext, name, prefix+".build.context", "build context", dir, stackDir)
+			if build.Dockerfile != "" {
+				dockerfile := build.Dockerfile
+				if !filepath.IsAbs(dockerfile) {
+					dockerfile = filepath.Join(dir, dockerfile)
+				}
+				c.stackFile(RuleBuildContext, name, prefix+".build.dockerfile", "dockerfile", dockerfile, stackDir)
+			}
+		}
+		for key, dir := range build.AdditionalContexts {
+			if remoteContext(dir) || strings.HasPrefix(dir, "service:") {
+				continue
+			}
+			c.stackFile(RuleBuildContext, name, prefix+".build.additional_contexts."+key, "build context", dir, stackDir)
+		}
+	}
+	for i, file := range svc.EnvFile {
+		c.stackFile(RuleEnvFile, name, fmt.Sprintf("%s.env_file[%d]", prefix, i), "env file", file.Path, stackDir)
+	}
+}
+
+// stackFile adds a violation when source, resolved like a bind source, lies
+// outside the stack directory.
+func (c *checker) stackFile(rule, service, path, what, source, stackDir string) {
+	if !filepath.IsAbs(source) {
+		source = filepath.Join(stackDir, source)
+	}
+	if !withinRoots(source, c.stackRoot) {
+		c.add(rule, service, path, fmt.Sprintf("%s %s is outside the stack directory", what, source))
+	}
+}
+
+// remoteContext reports whether a build context is fetched by the builder,
+// such as a git repository, a tarball URL or an image, rather than read from
+// the host.
+func remoteContext(context string) bool {
+	return strings.Contains(context, "://") || strings.HasPrefix(context, "git@") || strings.HasPrefix(context, "github.com/")
+}
+
+func (c *checker) bindSource(service, path, source, stackDir string) {
+	if !filepath.IsAbs(source) {
+		source = filepath.Join(stackDir, source)
+	}
+	if !withinRoots(source, c.roots) {
+		c.add(RuleBindMount, service, path, fmt.Sprintf("bind mount of %s is outside the stack directory", source))
+	}
+}
+
+// parseVolume accepts the long syntax compose config prints and, for older
+// releases, the short "source:target[:mode]" form.
+func parseVolume(raw json.RawMessage) (volumeMount, bool) {
+	var mount volumeMount
+	if err := json.Unmarshal(raw, &mount); err == nil {
+		return mount, true
+	}
+
+	var short string
+	if err := json.Unmarshal(raw, &short); err != nil {
+		return mount, false
+	}
+	source, _, ok := strings.Cut(short, ":")
+	if !ok {
+		return volumeMount{Type: "volume"}, true
+	}
+	if strings.HasPrefix(source, "/") || strings.HasPrefix(source, ".") || strings.HasPrefix(source, "~") {
+		return volumeMount{Type: "bind", Source: source}, true
+	}
+	return volumeMount{Type: "volume", Source: source}, true
+}
+
+// unconfined reports whether a security_opt entry, in either the "key=value"
+// or the older "key:value" form, lifts a confinement docker applies by
+// default.
+func unconfined(opt string) bool {
+	key, value, ok := strings.Cut(opt, "=")
+	if !ok {
+		key, value, _ = strings.Cut(opt, ":")
+	}
+	switch strings.ToLower(strings.TrimSpace(key)) {
+	case "seccomp", "apparmor", "systempaths":
+		return strings.EqualFold(strings.TrimSpace(value), "unconfined")
+	case "label":
+		return strings.EqualFold(strings.TrimSpace(value), "disable")
+	}
+	return false
+}
+
+func capabilityAllowed(capability string, allowed []string) bool {
+	capability = normalizeCapability(capability)
+	for _, a := range allowed {
+		if normalizeCapability(a) == capability {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeCapability(capability string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(capability)), "CAP_")
+}
+
+// bindRoots returns the stack directory and the extra allowed paths, each
+// also in its symlink-resolved form.
+func bindRoots(stackDir string, allowed []string) []string {
+	var roots []string
+	for _, root := range append([]string{stackDir}, allowed...) {
+		if root == "" || !filepath.IsAbs(root) {
+			continue
+		}
+		root = filepath.Clean(root)
+		roots = append(roots, root)
+		if resolved, err := filepath.EvalSymlinks(root); err == nil && resolved != root {
+			roots = append(roots, resolved)
+		}
+	}
+	return roots
+}
+
+// withinRoots reports whether path, and the file it resolves to, lie inside
+// one of roots. A symlink inside the stack directory pointing elsewhere is
+// therefore rejected, even when the bind source below it does not exist yet.
+func withinRoots(path string, roots []string) bool {
+	path = filepath.Clean(path)
+	if !underAny(path, roots) {
+		return false
+	}
+	resolved, err := resolveExisting(path)
+	if err != nil {
+		return false
+	}
+	return underAny(resolved, roots)
+}
+
+// resolveExisting resolves symlinks in the longest existing prefix of path
+// and appends the rest unchanged.
+func resolveExisting(path string) (string, error) {
+	rest := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+func underAny(path string, roots []string) bool {
+	for _, root := range roots {
+		if path == root || root == string(filepath.Separator) || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newStackDir returns a stack directory holding a data directory and a link
+// that points outside of it.
+func newStackDir(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	stackDir := filepath.Join(root, "game")
+	if err := os.MkdirAll(filepath.Join(stackDir, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(root, "outside")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(stackDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	return stackDir
+}
+
+func TestCheckRules(t *testing.T) {
+	stackDir := newStackDir(t)
+
+	tests := []struct {
+		name   string
+		config string
+		rules  Rules
+		want   []string
+	}{
+		{"empty", `{}`, Rules{}, nil},
+		{"plain service", `{"services":{"app":{"image":"nginx"}}}`, Rules{}, nil},
+
+		{"privileged", `{"services":{"app":{"privileged":true}}}`, Rules{}, []string{RulePrivileged}},
+		{"privileged allowed", `{"services":{"app":{"privileged":true}}}`, Rules{AllowPrivileged: true}, nil},
+
+		{"cap_add", `{"services":{"app":{"cap_add":["SYS_ADMIN"]}}}`, Rules{}, []string{RuleCapAdd}},
+		{"cap_add allowed", `{"services":{"app":{"cap_add":["cap_net_admin"]}}}`, Rules{AllowedCapabilities: []string{"NET_ADMIN"}}, nil},
+		{"cap_add other allowed", `{"services":{"app":{"cap_add":["SYS_ADMIN"]}}}`, Rules{AllowedCapabilities: []string{"NET_ADMIN"}}, []string{RuleCapAdd}},
+
+		{"host network", `{"services":{"app":{"network_mode":"host"}}}`, Rules{}, []string{RuleHostNetwork}},
+		{"host network allowed", `{"services":{"app":{"network_mode":"host"}}}`, Rules{AllowHostNetwork: true}, nil},
+		{"bridge network", `{"services":{"app":{"network_mode":"bridge"}}}`, Rules{}, nil},
+
+		{"host pid", `{"services":{"app":{"pid":"host"}}}`, Rules{}, []string{RuleHostPID}},
+		{"host pid allowed", `{"services":{"app":{"pid":"host"}}}`, Rules{AllowHostPID: true}, nil},
+
+		{"host ipc", `{"services":{"app":{"ipc":"host"}}}`, Rules{}, []string{RuleHostIPC}},
+		{"host ipc allowed", `{"services":{"app":{"ipc":"host"}}}`, Rules{AllowHostIPC: true}, nil},
+		{"shareable ipc", `{"services":{"app":{"ipc":"shareable"}}}`, Rules{}, nil},
+
+		{"host userns", `{"services":{"app":{"userns_mode":"host"}}}`, Rules{}, []string{RuleHostUserns}},
+		{"host userns allowed", `{"services":{"app":{"userns_mode":"host"}}}`, Rules{AllowHostUserns: true}, nil},
+
+		{"host cgroup", `{"services":{"app":{"cgroup":"host"}}}`, Rules{}, []string{RuleHostCgroup}},
+		{"host cgroup allowed", `{"services":{"app":{"cgroup":"host"}}}`, Rules{AllowHostCgroup: true}, nil},
+		{"private cgroup", `{"services":{"app":{"cgroup":"private"}}}`, Rules{}, nil},
+
+		{"cgroup parent", `{"services":{"app":{"cgroup_parent":"/system.slice"}}}`, Rules{}, []string{RuleCgroupParent}},
+		{"cgroup parent allowed", `{"services":{"app":{"cgroup_parent":"/system.slice"}}}`, Rules{AllowCgroupParent: true}, nil},
+
+		{"host uts", `{"services":{"app":{"uts":"host"}}}`, Rules{}, []string{RuleHostUTS}},
+		{"host uts allowed", `{"services":{"app":{"uts":"host"}}}`, Rules{AllowHostUTS: true}, nil},
+
+		{"container network", `{"services":{"app":{"network_mode":"container:db"}}}`, Rules{}, []string{RuleContainerNamespace}},
+		{"container pid and ipc", `{"services":{"app":{"pid":"container:db","ipc":"container:db"}}}`, Rules{}, []string{RuleContainerNamespace, RuleContainerNamespace}},
+		{"container namespace allowed", `{"services":{"app":{"network_mode":"container:db"}}}`, Rules{AllowContainerNS: true}, nil},
+		{"service network", `{"services":{"app":{"network_mode":"service:db"}}}`, Rules{}, nil},
+
+		{"devices", `{"services":{"app":{"devices":[{"source":"/dev/kvm","target":"/dev/kvm"}]}}}`, Rules{}, []string{RuleDevices}},
+		{"devices short form", `{"services":{"app":{"devices":["/dev/kvm:/dev/kvm"]}}}`, Rules{}, []string{RuleDevices}},
+		{"devices allowed", `{"services":{"app":{"devices":["/dev/kvm"]}}}`, Rules{AllowDevices: true}, nil},
+
+		{"seccomp unconfined", `{"services":{"app":{"security_opt":["seccomp=unconfined"]}}}`, Rules{}, []string{RuleUnconfined}},
+		{"apparmor unconfined", `{"services":{"app":{"security_opt":["apparmor:unconfined"]}}}`, Rules{}, []string{RuleUnconfined}},
+		{"label disable", `{"services":{"app":{"security_opt":["label=disable"]}}}`, Rules{}, []string{RuleUnconfined}},
+		{"systempaths unconfined", `{"services":{"app":{"security_opt":["systempaths=unconfined"]}}}`, Rules{}, []string{RuleUnconfined}},
+		{"no new privileges", `{"services":{"app":{"security_opt":["no-new-privileges:true"]}}}`, Rules{}, nil},
+		{"unconfined allowed", `{"services":{"app":{"security_opt":["seccomp=unconfined"]}}}`, Rules{AllowUnconfined: true}, nil},
+
+		{"volumes from container", `{"services":{"app":{"volumes_from":["container:other"]}}}`, Rules{}, []string{RuleVolumesFrom}},
+		{"volumes from service", `{"services":{"app":{"volumes_from":["db"]}}}`, Rules{}, nil},
+		{"volumes from allowed", `{"services":{"app":{"volumes_from":["container:other"]}}}`, Rules{AllowVolumesFrom: true}, nil},
+
+		{"external volume", `{"volumes":{"shared":{"external":true}}}`, Rules{}, []string{RuleExternalVolume}},
+		{"external volume legacy", `{"volumes":{"shared":{"external":{"name":"other"}}}}`, Rules{}, []string{RuleExternalVolume}},
+		{"external volume allowed", `{"volumes":{"shared":{"external":true}}}`, Rules{AllowExtVolumes: true}, nil},
+		{"local volume", `{"volumes":{"data":{}}}`, Rules{}, nil},
+
+		{"bind inside stack", `{"services":{"app":{"volumes":[{"type":"bind","source":"` + stackDir + `/data","target":"/data"}]}}}`, Rules{}, nil},
+		{"bind relative", `{"services":{"app":{"volumes":["./data:/data"]}}}`, Rules{}, nil},
+		{"bind outside stack", `{"services":{"app":{"volumes":[{"type":"bind","source":"/etc","target":"/etc"}]}}}`, Rules{}, []string{RuleBindMount}},
+		{"bind short form outside", `{"services":{"app":{"volumes":["/var/run/docker.sock:/var/run/docker.sock"]}}}`, Rules{}, []string{RuleBindMount}},
+		{"bind parent escape", `{"services":{"app":{"volumes":["../other:/data"]}}}`, Rules{}, []string{RuleBindMount}},
+		{"bind through symlink", `{"services":{"app":{"volumes":["./link/x:/data"]}}}`, Rules{}, []string{RuleBindMount}},
+		{"bind allowed path", `{"services":{"app":{"volumes":["/srv/shared/maps:/maps"]}}}`, Rules{AllowedBindPaths: []string{"/srv/shared"}}, nil},
+		{"named volume", `{"services":{"app":{"volumes":[{"type":"volume","source":"data","target":"/data"}]}}}`, Rules{}, nil},
+		{"volume device bind", `{"volumes":{"data":{"driver_opts":{"type":"none","o":"bind","device":"/etc"}}}}`, Rules{}, []string{RuleBindMount}},
+		{"config file outside", `{"configs":{"c":{"file":"/etc/passwd"}}}`, Rules{}, []string{RuleBindMount}},
+		{"secret file outside", `{"secrets":{"s":{"file":"/etc/vestri/api.key"}}}`, Rules{}, []string{RuleBindMount}},
+		{"secret file inside", `{"secrets":{"s":{"file":"./data/key"}}}`, Rules{}, nil},
+
+		{"build inside stack", `{"services":{"app":{"build":{"context":"` + stackDir + `","dockerfile":"Dockerfile"}}}}`, Rules{}, nil},
+		{"build outside stack", `{"services":{"app":{"build":{"context":"/etc/vestri","dockerfile":"Dockerfile"}}}}`, Rules{}, []string{RuleBuildContext, RuleBuildContext}},
+		{"build through symlink", `{"services":{"app":{"build":{"context":"./link"}}}}`, Rules{}, []string{RuleBuildContext}},
+		{"build outside allowed bind path", `{"services":{"app":{"build":{"context":"/srv/shared"}}}}`, Rules{AllowedBindPaths: []string{"/srv/shared"}}, []string{RuleBuildContext}},
+		{"dockerfile escape", `{"services":{"app":{"build":{"context":"./data","dockerfile":"../../outside/Dockerfile"}}}}`, Rules{}, []string{RuleBuildContext}},
+		{"dockerfile absolute", `{"services":{"app":{"build":{"context":".","dockerfile":"/etc/Dockerfile"}}}}`, Rules{}, []string{RuleBuildContext}},
+		{"build git context", `{"services":{"app":{"build":{"context":"https://github.com/example/app.git","dockerfile":"Dockerfile"}}}}`, Rules{}, nil},
+		{"additional context outside", `{"services":{"app":{"build":{"context":".","additional_contexts":{"keys":"/root/.ssh"}}}}}`, Rules{}, []string{RuleBuildContext}},
+		{"additional context image", `{"services":{"app":{"build":{"context":".","additional_contexts":{"base":"docker-image://alpine"}}}}}`, Rules{}, nil},
+
+		{"env file inside", `{"services":{"app":{"env_file":[{"path":"` + stackDir + `/app.env","required":true}]}}}`, Rules{}, nil},
+		{"env file outside", `{"services":{"app":{"env_file":[{"path":"/etc/vestri/worker.env"}]}}}`, Rules{}, []string{RuleEnvFile}},
+		{"env file short form outside", `{"services":{"app":{"env_file":["/etc/shadow"]}}}`, Rules{}, []string{RuleEnvFile}},
+		{"env file through symlink", `{"services":{"app":{"env_file":["./link/app.env"]}}}`, Rules{}, []string{RuleEnvFile}},
+		{"env file outside allowed bind path", `{"services":{"app":{"env_file":["/srv/shared/app.env"]}}}`, Rules{AllowedBindPaths: []string{"/srv/shared"}}, []string{RuleEnvFile}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := Check([]byte(tt.config), stackDir, tt.rules)
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			var got []string
+			for _, v := range violations {
+				got = append(got, v.Rule)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("rules = %v, want %v; violations %+v", got, tt.want, violations)
+			}
+		})
+	}
+}
+
+func TestCheckViolationFields(t *testing.T) {
+	stackDir := newStackDir(t)
+
+	config := `{"services":{"web":{"privileged":true,"volumes":["./data:/data","/etc:/host"]}}}`
+	violations, err := Check([]byte(config), stackDir, Rules{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 2 {
+		t.Fatalf("violations = %+v", violations)
+	}
+	if v := violations[0]; v.Rule != RulePrivileged || v.Service != "web" || v.Path != "services.web.privileged" {
+		t.Errorf("first = %+v", v)
+	}
+	if v := violations[1]; v.Rule != RuleBindMount || v.Path != "services.web.volumes[1]" || !strings.Contains(v.Message, "/etc") {
+		t.Errorf("second = %+v", v)
+	}
+
+	msg := (&Error{Violations: violations}).Error()
+	if !strings.HasPrefix(msg, "compose policy violation: services.web.privileged: ") {
+		t.Errorf("error = %q", msg)
+	}
+}
+
+func TestCheckInvalidConfig(t *testing.T) {
+	if _, err := Check([]byte(`not json`), t.TempDir(), Rules{}); err == nil {
+		t.Error("expected an error for invalid json")
+	}
+}
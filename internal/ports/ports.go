@@ -0,0 +1,390 @@
+// Package ports hands out host ports to stacks from configured TCP and UDP
+// ranges. Assignments are persisted to a JSON state file so they survive
+// restarts, and every new port is probed on the host before it is given out.
+package ports
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ProtocolTCP  = "tcp"
+	ProtocolUDP  = "udp"
+	ProtocolBoth = "both"
+)
+
+var (
+	ErrExhausted       = errors.New("no free port left in range")
+	ErrPortInUse       = errors.New("port is already in use")
+	ErrInvalidProtocol = errors.New("protocol must be tcp, udp or both")
+	ErrInvalidPort     = errors.New("port must be between 1 and 65535")
+	ErrOutOfRange      = errors.New("port is outside the configured range")
+)
+
+type Range struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// ParseRange parses "start-end" or a single port. An empty string is an empty
+// range that never assigns anything.
+func ParseRange(s string) (Range, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Range{}, nil
+	}
+	startValue, endValue, ok := strings.Cut(s, "-")
+	if !ok {
+		endValue = startValue
+	}
+	start, err := strconv.Atoi(strings.TrimSpace(startValue))
+	if err != nil {
+		return Range{}, fmt.Errorf("invalid port range %q", s)
+	}
+	end, err := strconv.Atoi(strings.TrimSpace(endValue))
+	if err != nil {
+		return Range{}, fmt.Errorf("invalid port range %q", s)
+	}
+	if start < 1 || end > 65535 || start > end {
+		return Range{}, fmt.Errorf("invalid port range %q", s)
+	}
+	return Range{Start: start, End: end}, nil
+}
+
+func (r Range) Empty() bool {
+	return r.Start == 0 && r.End == 0
+}
+
+// Assignment binds a named port of a stack, e.g. GAME_PORT, to a host port.
+type Assignment struct {
+	Stack      string    `json:"stack"`
+	Name       string    `json:"name"`
+	Protocol   string    `json:"protocol"`
+	Port       int       `json:"port"`
+	AssignedAt time.Time `json:"assigned_at"`
+}
+
+// Request asks for a named port. Port selects a specific host port instead
+// of the next free one in range.
+type Request struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	Port     int    `json:"port,omitempty"`
+}
+
+type state struct {
+	Assignments []Assignment `json:"assignments"`
+}
+
+type Allocator struct {
+	mu   sync.Mutex
+	path string
+	tcp  Range
+	udp  Range
+
+	// probe reports whether a port can currently be bound on the host.
+	probe func(protocol string, port int) bool
+}
+
+func New(path string, tcp, udp Range) *Allocator {
+	return &Allocator{path: path, tcp: tcp, udp: udp, probe: hostPortFree}
+}
+
+func (a *Allocator) Ranges() (tcp, udp Range) {
+	return a.tcp, a.udp
+}
+
+// List returns the assignments of one stack, or of every stack when stack
+// is empty.
+func (a *Allocator) List(stack string) ([]Assignment, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	st, err := a.load()
+	if err != nil {
+		return nil, err
+	}
+	list := []Assignment{}
+	for _, as := range st.Assignments {
+		if stack == "" || as.Stack == stack {
+			list = append(list, as)
+		}
+	}
+	return list, nil
+}
+
+// Allocate assigns a port for every request and returns the stack's
+// assignments for them in request order. Names the stack already holds keep
+// their port unless the protocol or requested port changed. Either every
+// request is satisfied or nothing is recorded.
+func (a *Allocator) Allocate(stack string, reqs []Request) ([]Assignment, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	st, err := a.load()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	result := make([]Assignment, 0, len(reqs))
+	for _, req := range reqs {
+		protocol := strings.ToLower(req.Protocol)
+		if protocol == "" {
+			protocol = ProtocolTCP
+		}
+		if protocol != ProtocolTCP && protocol != ProtocolUDP && protocol != ProtocolBoth {
+			return nil, ErrInvalidProtocol
+		}
+
+		idx := st.find(stack, req.Name)
+		if idx >= 0 {
+			current := st.Assignments[idx]
+			if current.Protocol == protocol && (req.Port == 0 || req.Port == current.Port) {
+				result = append(result, current)
+				continue
+			}
+			st.Assignments = append(st.Assignments[:idx], st.Assignments[idx+1:]...)
+		}
+
+		port, err := a.pick(st, protocol, req.Port)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", req.Name, err)
+		}
+		as := Assignment{Stack: stack, Name: req.Name, Protocol: protocol, Port: port, AssignedAt: now}
+		st.Assignments = append(st.Assignments, as)
+		result = append(result, as)
+	}
+
+	if err := a.save(st); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Release frees the named ports of a stack, or all of them when names is
+// empty, and returns what was released.
+func (a *Allocator) Release(stack string, names []string) ([]Assignment, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	st, err := a.load()
+	if err != nil {
+		return nil, err
+	}
+
+	release := make(map[string]bool, len(names))
+	for _, name := range names {
+		release[name] = true
+	}
+
+	released := []Assignment{}
+	kept := st.Assignments[:0]
+	for _, as := range st.Assignments {
+		if as.Stack == stack && (len(names) == 0 || release[as.Name]) {
+			released = append(released, as)
+			continue
+		}
+		kept = append(kept, as)
+	}
+	if len(released) == 0 {
+		return released, nil
+	}
+	st.Assignments = kept
+	if err := a.save(st); err != nil {
+		return nil, err
+	}
+	return released, nil
+}
+
+// Restore undoes an Allocate for the named ports of a stack: each is put back
+// to its assignment in previous, or released when previous does not hold it.
+// A previous port that another stack has taken since is not restored.
+func (a *Allocator) Restore(stack string, names []string, previous []Assignment) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	st, err := a.load()
+	if err != nil {
+		return err
+	}
+
+	restore := make(map[string]bool, len(names))
+	for _, name := range names {
+		restore[name] = true
+	}
+	kept := st.Assignments[:0]
+	for _, as := range st.Assignments {
+		if as.Stack == stack && restore[as.Name] {
+			continue
+		}
+		kept = append(kept, as)
+	}
+	st.Assignments = kept
+
+	var lost []string
+	for _, as := range previous {
+		if as.Stack != stack || !restore[as.Name] {
+			continue
+		}
+		if st.taken(as.Protocol, as.Port) {
+			lost = append(lost, as.Name)
+			continue
+		}
+		st.Assignments = append(st.Assignments, as)
+	}
+
+	if err := a.save(st); err != nil {
+		return err
+	}
+	if len(lost) > 0 {
+		return fmt.Errorf("%s: %w", strings.Join(lost, ", "), ErrPortInUse)
+	}
+	return nil
+}
+
+// pick returns preferred when it is in range and free, otherwise the first
+// free port in the range for protocol. Ports for both protocols come from
+// the overlap of the TCP and UDP ranges.
+func (a *Allocator) pick(st *state, protocol string, preferred int) (int, error) {
+	if preferred != 0 && (preferred < 1 || preferred > 65535) {
+		return 0, fmt.Errorf("%d: %w", preferred, ErrInvalidPort)
+	}
+
+	r := a.tcp
+	switch protocol {
+	case ProtocolUDP:
+		r = a.udp
+	case ProtocolBoth:
+		r = Range{Start: max(a.tcp.Start, a.udp.Start), End: min(a.tcp.End, a.udp.End)}
+		if a.tcp.Empty() || a.udp.Empty() || r.Start > r.End {
+			r = Range{}
+		}
+	}
+
+	if preferred != 0 {
+		if r.Empty() || preferred < r.Start || preferred > r.End {
+			return 0, fmt.Errorf("%d: %w", preferred, ErrOutOfRange)
+		}
+		if st.taken(protocol, preferred) || !a.free(protocol, preferred) {
+			return 0, fmt.Errorf("%d: %w", preferred, ErrPortInUse)
+		}
+		return preferred, nil
+	}
+
+	if r.Empty() {
+		return 0, ErrExhausted
+	}
+	for port := r.Start; port <= r.End; port++ {
+		if !st.taken(protocol, port) && a.free(protocol, port) {
+			return port, nil
+		}
+	}
+	return 0, ErrExhausted
+}
+
+func (a *Allocator) free(protocol string, port int) bool {
+	if protocol == ProtocolBoth {
+		return a.probe(ProtocolTCP, port) && a.probe(ProtocolUDP, port)
+	}
+	return a.probe(protocol, port)
+}
+
+func (st *state) find(stack, name string) int {
+	for i, as := range st.Assignments {
+		if as.Stack == stack && as.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (st *state) taken(protocol string, port int) bool {
+	for _, as := range st.Assignments {
+		if as.Port == port && overlaps(as.Protocol, protocol) {
+			return true
+		}
+	}
+	return false
+}
+
+func overlaps(a, b string) bool {
+	return a == b || a == ProtocolBoth || b == ProtocolBoth
+}
+
+func (a *Allocator) load() (*state, error) {
+	st := &state{}
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return st, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("invalid port state: %w", err)
+	}
+	return st, nil
+}
+
+func (a *Allocator) save(st *state) error {
+	sort.Slice(st.Assignments, func(i, j int) bool {
+		if st.Assignments[i].Stack != st.Assignments[j].Stack {
+			return st.Assignments[i].Stack < st.Assignments[j].Stack
+		}
+		return st.Assignments[i].Name < st.Assignments[j].Name
+	})
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(a.path), "."+filepath.Base(a.path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), a.path)
+}
+
+func hostPortFree(protocol string, port int) bool {
+	addr := ":" + strconv.Itoa(port)
+	if protocol == ProtocolUDP {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return false
+	}
+	ln.Close()
+	return true
+}
@@ -0,0 +1,200 @@
+package ports
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// newTestAllocator returns an allocator on a temporary state file whose probe
+// reports the ports in busy as bound on the host.
+func newTestAllocator(t *testing.T, tcp, udp Range, busy ...int) *Allocator {
+	t.Helper()
+
+	a := New(filepath.Join(t.TempDir(), "ports.json"), tcp, udp)
+	a.probe = func(protocol string, port int) bool {
+		for _, b := range busy {
+			if b == port {
+				return false
+			}
+		}
+		return true
+	}
+	return a
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Range
+		ok   bool
+	}{
+		{"", Range{}, true},
+		{"30000-30010", Range{30000, 30010}, true},
+		{" 25565 ", Range{25565, 25565}, true},
+		{"0-10", Range{}, false},
+		{"10-5", Range{}, false},
+		{"1-65536", Range{}, false},
+		{"a-b", Range{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseRange(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseRange(%q) = %+v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestTaken(t *testing.T) {
+	st := &state{Assignments: []Assignment{
+		{Stack: "a", Name: "TCP", Protocol: ProtocolTCP, Port: 100},
+		{Stack: "a", Name: "UDP", Protocol: ProtocolUDP, Port: 101},
+		{Stack: "b", Name: "BOTH", Protocol: ProtocolBoth, Port: 102},
+	}}
+
+	tests := []struct {
+		protocol string
+		port     int
+		want     bool
+	}{
+		{ProtocolTCP, 100, true},
+		{ProtocolUDP, 100, false},
+		{ProtocolBoth, 100, true},
+		{ProtocolUDP, 101, true},
+		{ProtocolTCP, 101, false},
+		{ProtocolTCP, 102, true},
+		{ProtocolUDP, 102, true},
+		{ProtocolTCP, 103, false},
+	}
+	for _, tt := range tests {
+		if got := st.taken(tt.protocol, tt.port); got != tt.want {
+			t.Errorf("taken(%s, %d) = %v, want %v", tt.protocol, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestPick(t *testing.T) {
+	a := newTestAllocator(t, Range{100, 105}, Range{103, 110}, 100)
+	st := &state{Assignments: []Assignment{
+		{Stack: "a", Name: "X", Protocol: ProtocolTCP, Port: 101},
+		{Stack: "a", Name: "Y", Protocol: ProtocolUDP, Port: 103},
+	}}
+
+	tests := []struct {
+		name      string
+		protocol  string
+		preferred int
+		want      int
+		err       error
+	}{
+		{"tcp skips bound and held ports", ProtocolTCP, 0, 102, nil},
+		{"udp skips held ports", ProtocolUDP, 0, 104, nil},
+		{"both uses the overlap", ProtocolBoth, 0, 104, nil},
+		{"preferred free", ProtocolTCP, 105, 105, nil},
+		{"preferred held", ProtocolTCP, 101, 0, ErrPortInUse},
+		{"preferred bound on host", ProtocolTCP, 100, 0, ErrPortInUse},
+		{"preferred udp outside range", ProtocolUDP, 100, 0, ErrOutOfRange},
+		{"preferred both outside overlap", ProtocolBoth, 102, 0, ErrOutOfRange},
+		{"preferred invalid", ProtocolTCP, 70000, 0, ErrInvalidPort},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.pick(st, tt.protocol, tt.preferred)
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Errorf("pick = %d, %v, want %d, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestPickExhausted(t *testing.T) {
+	a := newTestAllocator(t, Range{100, 101}, Range{}, 100)
+	st := &state{Assignments: []Assignment{{Stack: "a", Name: "X", Protocol: ProtocolTCP, Port: 101}}}
+
+	if _, err := a.pick(st, ProtocolTCP, 0); !errors.Is(err, ErrExhausted) {
+		t.Errorf("tcp: err = %v, want ErrExhausted", err)
+	}
+	if _, err := a.pick(st, ProtocolUDP, 0); !errors.Is(err, ErrExhausted) {
+		t.Errorf("empty udp range: err = %v, want ErrExhausted", err)
+	}
+	if _, err := a.pick(st, ProtocolBoth, 0); !errors.Is(err, ErrExhausted) {
+		t.Errorf("no overlap: err = %v, want ErrExhausted", err)
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	a := newTestAllocator(t, Range{100, 110}, Range{100, 110})
+
+	got, err := a.Allocate("game", []Request{{Name: "GAME_PORT", Protocol: "UDP"}, {Name: "RCON_PORT"}})
+	if err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+	if len(got) != 2 || got[0].Port != 100 || got[0].Protocol != ProtocolUDP || got[1].Port != 100 || got[1].Protocol != ProtocolTCP {
+		t.Fatalf("assignments = %+v", got)
+	}
+
+	// Held names keep their port; another stack gets the next free one.
+	again, err := a.Allocate("game", []Request{{Name: "RCON_PORT"}})
+	if err != nil || again[0].Port != 100 {
+		t.Errorf("repeat = %+v, %v", again, err)
+	}
+	other, err := a.Allocate("other", []Request{{Name: "RCON_PORT", Protocol: ProtocolBoth}})
+	if err != nil || other[0].Port != 101 {
+		t.Errorf("other stack = %+v, %v", other, err)
+	}
+
+	// A changed preferred port moves the assignment.
+	moved, err := a.Allocate("game", []Request{{Name: "RCON_PORT", Port: 105}})
+	if err != nil || moved[0].Port != 105 {
+		t.Errorf("moved = %+v, %v", moved, err)
+	}
+
+	// A failing request records nothing.
+	if _, err := a.Allocate("game", []Request{{Name: "NEW_PORT"}, {Name: "BAD", Protocol: "sctp"}}); !errors.Is(err, ErrInvalidProtocol) {
+		t.Errorf("invalid protocol: err = %v", err)
+	}
+	if _, err := a.Allocate("game", []Request{{Name: "NEW_PORT"}, {Name: "TAKEN", Port: 101}}); !errors.Is(err, ErrPortInUse) {
+		t.Errorf("taken port: err = %v", err)
+	}
+	list, err := a.List("game")
+	if err != nil || len(list) != 2 {
+		t.Errorf("game holds %+v, %v", list, err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	a := newTestAllocator(t, Range{100, 110}, Range{100, 110})
+
+	held, err := a.Allocate("game", []Request{{Name: "GAME_PORT"}, {Name: "RCON_PORT"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Allocate("game", []Request{{Name: "RCON_PORT", Port: 108}, {Name: "QUERY_PORT"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Restore("game", []string{"RCON_PORT", "QUERY_PORT"}, held); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	list, err := a.List("game")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Name != "GAME_PORT" || list[0].Port != 100 || list[1].Name != "RCON_PORT" || list[1].Port != 101 {
+		t.Errorf("after restore: %+v", list)
+	}
+
+	// A port another stack took in between stays with that stack.
+	if _, err := a.Allocate("game", []Request{{Name: "RCON_PORT", Port: 108}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Allocate("other", []Request{{Name: "PORT", Port: 101}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Restore("game", []string{"RCON_PORT"}, held); !errors.Is(err, ErrPortInUse) {
+		t.Errorf("restore taken port: err = %v, want ErrPortInUse", err)
+	}
+	if list, _ := a.List("other"); len(list) != 1 || list[0].Port != 101 {
+		t.Errorf("other stack = %+v", list)
+	}
+}
@@ -0,0 +1,257 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"time"
+)
+
+const (
+	a2sInfo      = 0x54
+	a2sPlayer    = 0x55
+	a2sInfoReply = 0x49
+	a2sPlayerRep = 0x44
+	a2sChallenge = 0x41
+
+	a2sSinglePacket = -1
+	a2sSplitPacket  = -2
+	a2sMaxPackets   = 32
+)
+
+var a2sInfoPayload = []byte("Source Engine Query\x00")
+
+// A2S queries a Source engine compatible server with A2S_INFO followed by
+// A2S_PLAYER. Player list failures are ignored since many servers disable it.
+func A2S(ctx context.Context, addr string, timeout time.Duration) (*Info, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	started := time.Now()
+	data, err := a2sRequest(conn, a2sInfo, a2sInfoPayload, nil)
+	if err != nil {
+		return nil, err
+	}
+	latency := time.Since(started)
+
+	info, err := parseA2SInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	info.LatencyMS = latency.Milliseconds()
+
+	if data, err := a2sRequest(conn, a2sPlayer, nil, []byte{0xff, 0xff, 0xff, 0xff}); err == nil {
+		if players, err := parseA2SPlayers(data); err == nil {
+			info.PlayerList = players
+		}
+	}
+	return info, nil
+}
+
+// a2sRequest sends a request and answers a challenge if the server sends
+// one. The returned payload starts with the response header byte.
+func a2sRequest(conn net.Conn, header byte, payload, challenge []byte) ([]byte, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		packet := []byte{0xff, 0xff, 0xff, 0xff, header}
+		packet = append(packet, payload...)
+		packet = append(packet, challenge...)
+		if _, err := conn.Write(packet); err != nil {
+			return nil, err
+		}
+
+		data, err := a2sRead(conn)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			return nil, ErrInvalidResponse
+		}
+		if data[0] != a2sChallenge {
+			return data, nil
+		}
+		if len(data) < 5 {
+			return nil, ErrInvalidResponse
+		}
+		challenge = data[1:5]
+	}
+	return nil, fmt.Errorf("query: too many challenges")
+}
+
+// a2sRead reads one response, reassembling split packets.
+func a2sRead(conn net.Conn) ([]byte, error) {
+	buf := make([]byte, 65535)
+	var (
+		parts [][]byte
+		total int
+		id    int32
+	)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if n < 4 {
+			return nil, ErrInvalidResponse
+		}
+
+		switch int32(binary.LittleEndian.Uint32(buf[:4])) {
+		case a2sSinglePacket:
+			return append([]byte(nil), buf[4:n]...), nil
+		case a2sSplitPacket:
+		default:
+			return nil, ErrInvalidResponse
+		}
+
+		// Source split header: id (4), total (1), number (1), size (2).
+		if n < 12 {
+			return nil, ErrInvalidResponse
+		}
+		packetID := int32(binary.LittleEndian.Uint32(buf[4:8]))
+		if uint32(packetID)&0x80000000 != 0 {
+			return nil, fmt.Errorf("query: compressed responses are not supported")
+		}
+		count, number := int(buf[8]), int(buf[9])
+		if count == 0 || count > a2sMaxPackets || number >= count {
+			return nil, ErrInvalidResponse
+		}
+		if parts == nil {
+			parts = make([][]byte, count)
+			id = packetID
+		} else if packetID != id || count != len(parts) {
+			continue
+		}
+		if parts[number] == nil {
+			parts[number] = append([]byte(nil), buf[12:n]...)
+			total++
+		}
+		if total < len(parts) {
+			continue
+		}
+
+		joined := bytes.Join(parts, nil)
+		if len(joined) < 4 || int32(binary.LittleEndian.Uint32(joined[:4])) != a2sSinglePacket {
+			return nil, ErrInvalidResponse
+		}
+		return joined[4:], nil
+	}
+}
+
+func parseA2SInfo(data []byte) (*Info, error) {
+	r := &a2sReader{data: data}
+	if r.byte() != a2sInfoReply {
+		return nil, ErrInvalidResponse
+	}
+
+	info := &Info{Protocol: ProtocolA2S, PlayerList: []Player{}}
+	r.byte() // protocol version
+	info.Name = r.string()
+	info.Map = r.string()
+	r.string() // folder
+	info.Game = r.string()
+	r.uint16() // steam app id
+	info.Players = int(r.byte())
+	info.MaxPlayers = int(r.byte())
+	info.Bots = int(r.byte())
+	r.byte() // server type
+	r.byte() // environment
+	info.Password = r.byte() == 1
+	r.byte() // vac
+	info.Version = r.string()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return info, nil
+}
+
+func parseA2SPlayers(data []byte) ([]Player, error) {
+	r := &a2sReader{data: data}
+	if r.byte() != a2sPlayerRep {
+		return nil, ErrInvalidResponse
+	}
+
+	count := int(r.byte())
+	players := make([]Player, 0, count)
+	for i := 0; i < count && r.err == nil; i++ {
+		r.byte() // index
+		player := Player{
+			Name:  r.string(),
+			Score: int(int32(r.uint32())),
+		}
+		player.Duration = float64(math.Float32frombits(r.uint32()))
+		if r.err == nil {
+			players = append(players, player)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return players, nil
+}
+
+type a2sReader struct {
+	data []byte
+	err  error
+}
+
+func (r *a2sReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = ErrInvalidResponse
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *a2sReader) byte() byte {
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *a2sReader) uint16() uint16 {
+	if b := r.take(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *a2sReader) uint32() uint32 {
+	if b := r.take(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *a2sReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	idx := bytes.IndexByte(r.data, 0)
+	if idx < 0 {
+		r.err = ErrInvalidResponse
+		return ""
+	}
+	s := string(r.data[:idx])
+	r.data = r.data[idx+1:]
+	return s
+}
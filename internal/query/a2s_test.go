@@ -0,0 +1,152 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+var testChallenge = []byte{0x01, 0x02, 0x03, 0x04}
+
+// newA2SServer answers A2S_INFO and A2S_PLAYER on a local UDP socket. Every
+// request without the expected challenge gets a challenge first, and the info
+// reply is split into packets sent out of order and repeated.
+func newA2SServer(t *testing.T, info, players []byte) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1400)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			request := buf[:n]
+			if n < 9 || !bytes.HasPrefix(request, []byte{0xff, 0xff, 0xff, 0xff}) {
+				continue
+			}
+			if !bytes.HasSuffix(request, testChallenge) {
+				conn.WriteTo(append([]byte{0xff, 0xff, 0xff, 0xff, a2sChallenge}, testChallenge...), addr)
+				continue
+			}
+			switch request[4] {
+			case a2sInfo:
+				if !bytes.Equal(request[5:n-4], a2sInfoPayload) {
+					continue
+				}
+				payload := append([]byte{0xff, 0xff, 0xff, 0xff}, info...)
+				half := len(payload) / 2
+				second := splitPacket(7, 2, 1, payload[half:])
+				conn.WriteTo(second, addr)
+				conn.WriteTo(second, addr)
+				conn.WriteTo(splitPacket(7, 2, 0, payload[:half]), addr)
+			case a2sPlayer:
+				conn.WriteTo(append([]byte{0xff, 0xff, 0xff, 0xff}, players...), addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func splitPacket(id int32, count, number byte, data []byte) []byte {
+	header := binary.LittleEndian.AppendUint32(nil, uint32(0xfffffffe))
+	header = binary.LittleEndian.AppendUint32(header, uint32(id))
+	header = append(header, count, number)
+	header = binary.LittleEndian.AppendUint16(header, 1248)
+	return append(header, data...)
+}
+
+func a2sInfoReplyBytes() []byte {
+	b := []byte{a2sInfoReply, 17}
+	for _, s := range []string{"Test Server", "de_dust2", "csgo", "Counter-Strike"} {
+		b = append(append(b, s...), 0)
+	}
+	b = binary.LittleEndian.AppendUint16(b, 730)
+	b = append(b, 5, 24, 1, 'd', 'l', 1, 1)
+	return append(append(b, "1.38.7.9"...), 0)
+}
+
+func a2sPlayerReplyBytes() []byte {
+	b := []byte{a2sPlayerRep, 2}
+	for i, p := range []struct {
+		name     string
+		score    int32
+		duration float32
+	}{{"alice", 12, 61.5}, {"bob", -3, 2}} {
+		b = append(b, byte(i))
+		b = append(append(b, p.name...), 0)
+		b = binary.LittleEndian.AppendUint32(b, uint32(p.score))
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(p.duration))
+	}
+	return b
+}
+
+func TestA2S(t *testing.T) {
+	addr := newA2SServer(t, a2sInfoReplyBytes(), a2sPlayerReplyBytes())
+
+	info, err := A2S(context.Background(), addr, time.Second)
+	if err != nil {
+		t.Fatalf("A2S: %v", err)
+	}
+	if info.Protocol != ProtocolA2S || info.Name != "Test Server" || info.Map != "de_dust2" || info.Game != "Counter-Strike" {
+		t.Errorf("info = %+v", info)
+	}
+	if info.Players != 5 || info.MaxPlayers != 24 || info.Bots != 1 || !info.Password || info.Version != "1.38.7.9" {
+		t.Errorf("info = %+v", info)
+	}
+	if len(info.PlayerList) != 2 {
+		t.Fatalf("players = %+v", info.PlayerList)
+	}
+	if p := info.PlayerList[0]; p.Name != "alice" || p.Score != 12 || p.Duration != 61.5 {
+		t.Errorf("first player = %+v", p)
+	}
+	if p := info.PlayerList[1]; p.Name != "bob" || p.Score != -3 {
+		t.Errorf("second player = %+v", p)
+	}
+}
+
+func TestA2SPlayersOptional(t *testing.T) {
+	addr := newA2SServer(t, a2sInfoReplyBytes(), []byte{0x00})
+
+	info, err := A2S(context.Background(), addr, time.Second)
+	if err != nil {
+		t.Fatalf("A2S: %v", err)
+	}
+	if info.Name != "Test Server" || len(info.PlayerList) != 0 {
+		t.Errorf("info = %+v", info)
+	}
+}
+
+func TestA2STimeout(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+
+	_, err = A2S(context.Background(), conn.LocalAddr().String(), 100*time.Millisecond)
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("err = %v, want a timeout", err)
+	}
+}
+
+func TestParseA2SInfoTruncated(t *testing.T) {
+	data := a2sInfoReplyBytes()
+	for _, n := range []int{0, 1, 10, len(data) - 1} {
+		if _, err := parseA2SInfo(data[:n]); !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("%d bytes: err = %v, want ErrInvalidResponse", n, err)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package query
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Servers answer a status request with any protocol version; -1 is the
+	// conventional "unknown" value used by ping tools.
+	minecraftProtocol   = -1
+	minecraftStatusNext = 1
+	maxMinecraftPacket  = 1 << 20
+)
+
+type minecraftStatus struct {
+	Version struct {
+		Name     string `json:"name"`
+		Protocol int    `json:"protocol"`
+	} `json:"version"`
+	Players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+		Sample []struct {
+			Name string `json:"name"`
+			ID   string `json:"id"`
+		} `json:"sample"`
+	} `json:"players"`
+	Description json.RawMessage `json:"description"`
+}
+
+// Minecraft performs a Server List Ping. host is sent in the handshake and
+// may differ from addr when the server sits behind a proxy.
+func Minecraft(ctx context.Context, addr, host string, timeout time.Duration) (*Info, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	_, portValue, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portValue, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		host, _, _ = net.SplitHostPort(addr)
+	}
+
+	var handshake bytes.Buffer
+	writeVarInt(&handshake, 0x00)
+	writeVarInt(&handshake, minecraftProtocol)
+	writeVarInt(&handshake, int32(len(host)))
+	handshake.WriteString(host)
+	binary.Write(&handshake, binary.BigEndian, uint16(port))
+	writeVarInt(&handshake, minecraftStatusNext)
+
+	started := time.Now()
+	if err := writePacket(conn, handshake.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := writePacket(conn, []byte{0x00}); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	packet, err := readPacket(reader)
+	if err != nil {
+		return nil, err
+	}
+	latency := time.Since(started)
+
+	r := bytes.NewReader(packet)
+	if id, err := readVarInt(r); err != nil || id != 0x00 {
+		return nil, ErrInvalidResponse
+	}
+	length, err := readVarInt(r)
+	if err != nil || length < 0 || int(length) > r.Len() {
+		return nil, ErrInvalidResponse
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	var status minecraftStatus
+	if err := json.Unmarshal(payload, &status); err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	info := &Info{
+		Protocol:   ProtocolMinecraft,
+		Name:       chatText(status.Description),
+		Version:    status.Version.Name,
+		Players:    status.Players.Online,
+		MaxPlayers: status.Players.Max,
+		PlayerList: []Player{},
+		LatencyMS:  latency.Milliseconds(),
+	}
+	for _, player := range status.Players.Sample {
+		info.PlayerList = append(info.PlayerList, Player{Name: player.Name, ID: player.ID})
+	}
+	return info, nil
+}
+
+// chatText flattens a chat component, which is either a plain string or an
+// object with text and extra children.
+func chatText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+
+	var component struct {
+		Text  string            `json:"text"`
+		Extra []json.RawMessage `json:"extra"`
+	}
+	if err := json.Unmarshal(raw, &component); err != nil {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(component.Text)
+	for _, extra := range component.Extra {
+		b.WriteString(chatText(extra))
+	}
+	return b.String()
+}
+
+func writePacket(w io.Writer, payload []byte) error {
+	var buf bytes.Buffer
+	writeVarInt(&buf, int32(len(payload)))
+	buf.Write(payload)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func readPacket(r *bufio.Reader) ([]byte, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if length <= 0 || length > maxMinecraftPacket {
+		return nil, ErrInvalidResponse
+	}
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+func writeVarInt(buf *bytes.Buffer, value int32) {
+	v := uint32(value)
+	for {
+		if v&^0x7f == 0 {
+			buf.WriteByte(byte(v))
+			return
+		}
+		buf.WriteByte(byte(v&0x7f) | 0x80)
+		v >>= 7
+	}
+}
+
+func readVarInt(r io.ByteReader) (int32, error) {
+	var value uint32
+	for shift := 0; shift < 35; shift += 7 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint32(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return int32(value), nil
+		}
+	}
+	return 0, errors.New("query: varint too long")
+}
@@ -0,0 +1,157 @@
+package query
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// newMinecraftServer answers one Server List Ping per connection with status
+// and reports the host each handshake carried on hosts.
+func newMinecraftServer(t *testing.T, status string, hosts chan<- string) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+
+				handshake, err := readPacket(r)
+				if err != nil {
+					return
+				}
+				hr := bytes.NewReader(handshake)
+				id, _ := readVarInt(hr)
+				protocol, _ := readVarInt(hr)
+				length, _ := readVarInt(hr)
+				host := make([]byte, length)
+				io.ReadFull(hr, host)
+				var port uint16
+				binary.Read(hr, binary.BigEndian, &port)
+				next, err := readVarInt(hr)
+				if err != nil || id != 0 || protocol != minecraftProtocol || next != minecraftStatusNext {
+					return
+				}
+				hosts <- string(host)
+
+				if request, err := readPacket(r); err != nil || !bytes.Equal(request, []byte{0x00}) {
+					return
+				}
+				var response bytes.Buffer
+				writeVarInt(&response, 0x00)
+				writeVarInt(&response, int32(len(status)))
+				response.WriteString(status)
+				writePacket(conn, response.Bytes())
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestMinecraft(t *testing.T) {
+	hosts := make(chan string, 2)
+	addr := newMinecraftServer(t, `{
+		"version": {"name": "1.20.4", "protocol": 765},
+		"players": {"max": 20, "online": 2, "sample": [{"name": "alice", "id": "4566e69f-c907-48ee-8d71-d7ba5aa00d20"}]},
+		"description": {"text": "A ", "extra": [{"text": "Minecraft", "extra": [" Server"]}]}
+	}`, hosts)
+
+	info, err := Minecraft(context.Background(), addr, "", time.Second)
+	if err != nil {
+		t.Fatalf("Minecraft: %v", err)
+	}
+	if host := <-hosts; host != "127.0.0.1" {
+		t.Errorf("handshake host = %q, want 127.0.0.1", host)
+	}
+	if info.Protocol != ProtocolMinecraft || info.Name != "A Minecraft Server" || info.Version != "1.20.4" {
+		t.Errorf("info = %+v", info)
+	}
+	if info.Players != 2 || info.MaxPlayers != 20 || len(info.PlayerList) != 1 || info.PlayerList[0].Name != "alice" {
+		t.Errorf("info = %+v", info)
+	}
+
+	if _, err := Minecraft(context.Background(), addr, "play.example.com", time.Second); err != nil {
+		t.Fatalf("Minecraft with host: %v", err)
+	}
+	if host := <-hosts; host != "play.example.com" {
+		t.Errorf("handshake host = %q, want play.example.com", host)
+	}
+}
+
+func TestMinecraftInvalidStatus(t *testing.T) {
+	addr := newMinecraftServer(t, `not json`, make(chan string, 1))
+
+	if _, err := Minecraft(context.Background(), addr, "", time.Second); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("err = %v, want ErrInvalidResponse", err)
+	}
+}
+
+func TestVarInt(t *testing.T) {
+	tests := []struct {
+		value   int32
+		encoded []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{255, []byte{0xff, 0x01}},
+		{25565, []byte{0xdd, 0xc7, 0x01}},
+		{2147483647, []byte{0xff, 0xff, 0xff, 0xff, 0x07}},
+		{-1, []byte{0xff, 0xff, 0xff, 0xff, 0x0f}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		writeVarInt(&buf, tt.value)
+		if !bytes.Equal(buf.Bytes(), tt.encoded) {
+			t.Errorf("writeVarInt(%d) = % x, want % x", tt.value, buf.Bytes(), tt.encoded)
+		}
+		value, err := readVarInt(bytes.NewReader(tt.encoded))
+		if err != nil || value != tt.value {
+			t.Errorf("readVarInt(% x) = %d, %v, want %d", tt.encoded, value, err, tt.value)
+		}
+	}
+
+	if _, err := readVarInt(bytes.NewReader([]byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x01})); err == nil {
+		t.Error("expected an error for a varint longer than 5 bytes")
+	}
+	if _, err := readVarInt(bytes.NewReader([]byte{0x80})); !errors.Is(err, io.EOF) {
+		t.Errorf("truncated varint: err = %v, want EOF", err)
+	}
+}
+
+func TestChatText(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{``, ""},
+		{`"plain motd"`, "plain motd"},
+		{`{"text": "only text"}`, "only text"},
+		{`{"text": "a", "extra": ["b", {"text": "c", "extra": [{"text": "d"}]}]}`, "abcd"},
+		{`{"extra": [{"text": "x", "bold": true}]}`, "x"},
+		{`42`, ""},
+	}
+	for _, tt := range tests {
+		if got := chatText([]byte(tt.raw)); got != tt.want {
+			t.Errorf("chatText(%s) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+// Package query asks game servers for their public status using the Valve
+// A2S protocol over UDP and the Minecraft Server List Ping over TCP.
+package query
+
+import "errors"
+
+const (
+	ProtocolA2S       = "a2s"
+	ProtocolMinecraft = "minecraft"
+)
+
+var ErrInvalidResponse = errors.New("query: invalid response")
+
+type Player struct {
+	Name     string  `json:"name"`
+	Score    int     `json:"score,omitempty"`
+	Duration float64 `json:"duration_seconds,omitempty"`
+	ID       string  `json:"id,omitempty"`
+}
+
+type Info struct {
+	Protocol   string   `json:"protocol"`
+	Name       string   `json:"name"`
+	Map        string   `json:"map,omitempty"`
+	Game       string   `json:"game,omitempty"`
+	Version    string   `json:"version,omitempty"`
+	Players    int      `json:"players"`
+	MaxPlayers int      `json:"max_players"`
+	Bots       int      `json:"bots,omitempty"`
+	Password   bool     `json:"password,omitempty"`
+	PlayerList []Player `json:"player_list"`
+	LatencyMS  int64    `json:"latency_ms"`
+}
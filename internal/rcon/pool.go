@@ -0,0 +1,135 @@
+package rcon
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Pool keeps one authenticated connection per key and closes connections
+// that stay unused for longer than the idle timeout.
+type Pool struct {
+	mu      sync.Mutex
+	idle    time.Duration
+	timeout time.Duration
+	conns   map[string]*pooledConn
+}
+
+type pooledConn struct {
+	client   *Client
+	addr     string
+	password string
+	lastUsed time.Time
+}
+
+func NewPool(timeout, idle time.Duration) *Pool {
+	return &Pool{
+		idle:    idle,
+		timeout: timeout,
+		conns:   make(map[string]*pooledConn),
+	}
+}
+
+// Execute runs command on the connection for key, dialing when there is none
+// or when addr or password changed. A broken pooled connection is replaced
+// and the command retried once.
+func (p *Pool) Execute(ctx context.Context, key, addr, password, command string) (string, error) {
+	for attempt := 0; ; attempt++ {
+		conn, reused, err := p.get(ctx, key, addr, password)
+		if err != nil {
+			return "", err
+		}
+
+		response, err := conn.client.Execute(ctx, command)
+		if err == nil {
+			p.mu.Lock()
+			conn.lastUsed = time.Now()
+			p.mu.Unlock()
+			return response, nil
+		}
+
+		p.drop(key, conn)
+		if !reused || attempt > 0 || ctx.Err() != nil || !isConnError(err) {
+			return "", err
+		}
+	}
+}
+
+// Forget closes and removes the connection for key.
+func (p *Pool) Forget(key string) {
+	p.mu.Lock()
+	conn := p.conns[key]
+	delete(p.conns, key)
+	p.mu.Unlock()
+
+	if conn != nil {
+		conn.client.Close()
+	}
+}
+
+func (p *Pool) get(ctx context.Context, key, addr, password string) (*pooledConn, bool, error) {
+	p.mu.Lock()
+	p.expireLocked(time.Now())
+	if conn, ok := p.conns[key]; ok {
+		if conn.addr == addr && conn.password == password {
+			conn.lastUsed = time.Now()
+			p.mu.Unlock()
+			return conn, true, nil
+		}
+		delete(p.conns, key)
+		conn.client.Close()
+	}
+	p.mu.Unlock()
+
+	client, err := Dial(ctx, addr, password, p.timeout)
+	if err != nil {
+		return nil, false, err
+	}
+	conn := &pooledConn{client: client, addr: addr, password: password, lastUsed: time.Now()}
+
+	// Another caller may have dialed the same key meanwhile; keep whichever
+	// connection was stored first and close our own.
+	p.mu.Lock()
+	if existing, ok := p.conns[key]; ok {
+		if existing.addr == addr && existing.password == password {
+			existing.lastUsed = time.Now()
+			p.mu.Unlock()
+			client.Close()
+			return existing, true, nil
+		}
+		existing.client.Close()
+	}
+	p.conns[key] = conn
+	p.mu.Unlock()
+	return conn, false, nil
+}
+
+func (p *Pool) drop(key string, conn *pooledConn) {
+	p.mu.Lock()
+	if p.conns[key] == conn {
+		delete(p.conns, key)
+	}
+	p.mu.Unlock()
+	conn.client.Close()
+}
+
+func (p *Pool) expireLocked(now time.Time) {
+	if p.idle <= 0 {
+		return
+	}
+	for key, conn := range p.conns {
+		if now.Sub(conn.lastUsed) > p.idle {
+			delete(p.conns, key)
+			conn.client.Close()
+		}
+	}
+}
+
+func isConnError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) || errors.As(err, &netErr)
+}
@@ -0,0 +1,195 @@
+// Package rcon implements the Source RCON protocol spoken by Source engine
+// games, Minecraft, ARK, Rust and others.
+package rcon
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	typeResponseValue = 0
+	typeExecCommand   = 2
+	typeAuthResponse  = 2
+	typeAuth          = 3
+
+	// Minecraft rejects packets larger than this; Source servers accept more.
+	maxCommandLength = 1446
+	maxPacketSize    = 4096 + 10
+	maxResponseSize  = 1 << 20
+)
+
+var (
+	ErrAuthFailed      = errors.New("rcon: authentication failed")
+	ErrCommandTooLong  = errors.New("rcon: command too long")
+	ErrResponseTooLong = errors.New("rcon: response too long")
+)
+
+type Client struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	timeout time.Duration
+	nextID  int32
+}
+
+type packet struct {
+	id   int32
+	typ  int32
+	body []byte
+}
+
+// Dial connects to addr and authenticates with password. timeout bounds the
+// dial, the authentication and every later command.
+func Dial(ctx context.Context, addr, password string, timeout time.Duration) (*Client, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{conn: conn, timeout: timeout}
+	if err := c.auth(password); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) auth(password string) error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	id := c.id()
+	if err := c.write(packet{id: id, typ: typeAuth, body: []byte(password)}); err != nil {
+		return err
+	}
+
+	// Source servers send an empty response value before the auth response;
+	// Minecraft sends only the auth response.
+	for {
+		p, err := c.read()
+		if err != nil {
+			return err
+		}
+		if p.typ != typeAuthResponse {
+			continue
+		}
+		if p.id == -1 || p.id != id {
+			return ErrAuthFailed
+		}
+		return nil
+	}
+}
+
+// Execute runs command and returns the server's response. Responses split
+// across several packets are reassembled by following the command with an
+// empty packet, which servers answer only after the command's output.
+func (c *Client) Execute(ctx context.Context, command string) (string, error) {
+	if len(command) > maxCommandLength {
+		return "", ErrCommandTooLong
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.conn.SetDeadline(deadline)
+	defer c.conn.SetDeadline(time.Time{})
+	stop := context.AfterFunc(ctx, func() { c.conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	id := c.id()
+	if err := c.write(packet{id: id, typ: typeExecCommand, body: []byte(command)}); err != nil {
+		return "", err
+	}
+	sentinel := c.id()
+	if err := c.write(packet{id: sentinel, typ: typeResponseValue}); err != nil {
+		return "", err
+	}
+
+	var response bytes.Buffer
+	for {
+		p, err := c.read()
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", err
+		}
+		switch p.id {
+		case id:
+			if response.Len()+len(p.body) > maxResponseSize {
+				return "", ErrResponseTooLong
+			}
+			response.Write(p.body)
+		case sentinel:
+			return response.String(), nil
+		case -1:
+			return "", ErrAuthFailed
+		}
+	}
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) id() int32 {
+	c.nextID++
+	if c.nextID <= 0 {
+		c.nextID = 1
+	}
+	return c.nextID
+}
+
+func (c *Client) write(p packet) error {
+	_, err := c.conn.Write(encodePacket(p))
+	return err
+}
+
+func (c *Client) read() (packet, error) {
+	return readPacket(c.conn)
+}
+
+func encodePacket(p packet) []byte {
+	size := int32(4 + 4 + len(p.body) + 2)
+	buf := make([]byte, 0, 4+size)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(size))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(p.id))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(p.typ))
+	buf = append(buf, p.body...)
+	return append(buf, 0, 0)
+}
+
+func readPacket(r io.Reader) (packet, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return packet{}, err
+	}
+
+	size := int32(binary.LittleEndian.Uint32(header[0:4]))
+	if size < 10 || size > maxPacketSize {
+		return packet{}, fmt.Errorf("rcon: invalid packet size %d", size)
+	}
+	p := packet{
+		id:  int32(binary.LittleEndian.Uint32(header[4:8])),
+		typ: int32(binary.LittleEndian.Uint32(header[8:12])),
+	}
+
+	body := make([]byte, size-8)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+	p.body = bytes.TrimRight(body, "\x00")
+	return p, nil
+}
@@ -0,0 +1,211 @@
+package rcon
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeServer speaks RCON like a Source server: an empty response value before
+// every auth response, and commands answered with the chunks in responses.
+type fakeServer struct {
+	addr      string
+	password  string
+	responses map[string][]string
+	accepted  atomic.Int32
+	open      atomic.Int32
+}
+
+func newFakeServer(t *testing.T, password string, responses map[string][]string) *fakeServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &fakeServer{addr: ln.Addr().String(), password: password, responses: responses}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.accepted.Add(1)
+			s.open.Add(1)
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer s.open.Add(-1)
+	defer conn.Close()
+
+	write := func(p packet) {
+		conn.Write(encodePacket(p))
+	}
+	for {
+		p, err := readPacket(conn)
+		if err != nil {
+			return
+		}
+		switch p.typ {
+		case typeAuth:
+			write(packet{id: p.id, typ: typeResponseValue})
+			if string(p.body) != s.password {
+				write(packet{id: -1, typ: typeAuthResponse})
+				continue
+			}
+			write(packet{id: p.id, typ: typeAuthResponse})
+		case typeExecCommand:
+			for _, chunk := range s.responses[string(p.body)] {
+				write(packet{id: p.id, typ: typeResponseValue, body: []byte(chunk)})
+			}
+		case typeResponseValue:
+			write(packet{id: p.id, typ: typeResponseValue})
+		}
+	}
+}
+
+func TestPacketFraming(t *testing.T) {
+	data := encodePacket(packet{id: 7, typ: typeExecCommand, body: []byte("list")})
+
+	if size := binary.LittleEndian.Uint32(data[0:4]); size != 4+4+4+2 {
+		t.Errorf("size = %d, want 14", size)
+	}
+	if len(data) != 4+14 || !bytes.HasSuffix(data, []byte{0, 0}) {
+		t.Errorf("packet = %q", data)
+	}
+
+	p, err := readPacket(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("readPacket: %v", err)
+	}
+	if p.id != 7 || p.typ != typeExecCommand || string(p.body) != "list" {
+		t.Errorf("packet = %+v", p)
+	}
+
+	for _, size := range []uint32{9, maxPacketSize + 1} {
+		bad := binary.LittleEndian.AppendUint32(nil, size)
+		bad = append(bad, make([]byte, 8)...)
+		if _, err := readPacket(bytes.NewReader(bad)); err == nil {
+			t.Errorf("size %d: expected an error", size)
+		}
+	}
+
+	if _, err := readPacket(bytes.NewReader(data[:len(data)-1])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated packet: err = %v", err)
+	}
+}
+
+func TestExecuteMultiPacket(t *testing.T) {
+	first := strings.Repeat("a", 4096)
+	server := newFakeServer(t, "secret", map[string][]string{
+		"cvarlist": {first, "bbb", "ccc"},
+		"status":   {"hostname: test"},
+	})
+
+	client, err := Dial(context.Background(), server.addr, "secret", time.Second)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+
+	response, err := client.Execute(context.Background(), "cvarlist")
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if response != first+"bbbccc" {
+		t.Errorf("response has %d bytes, want %d", len(response), len(first)+6)
+	}
+
+	response, err = client.Execute(context.Background(), "status")
+	if err != nil || response != "hostname: test" {
+		t.Errorf("second command = %q, %v", response, err)
+	}
+
+	response, err = client.Execute(context.Background(), "unknown")
+	if err != nil || response != "" {
+		t.Errorf("command without output = %q, %v", response, err)
+	}
+}
+
+func TestAuthFailure(t *testing.T) {
+	server := newFakeServer(t, "secret", nil)
+
+	_, err := Dial(context.Background(), server.addr, "wrong", time.Second)
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("err = %v, want ErrAuthFailed", err)
+	}
+}
+
+func TestCommandTooLong(t *testing.T) {
+	server := newFakeServer(t, "secret", nil)
+
+	client, err := Dial(context.Background(), server.addr, "secret", time.Second)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Execute(context.Background(), strings.Repeat("x", maxCommandLength+1)); !errors.Is(err, ErrCommandTooLong) {
+		t.Errorf("err = %v, want ErrCommandTooLong", err)
+	}
+}
+
+func TestPoolReusesConnection(t *testing.T) {
+	server := newFakeServer(t, "secret", map[string][]string{"list": {"ok"}})
+	pool := NewPool(time.Second, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if _, err := pool.Execute(context.Background(), "game", server.addr, "secret", "list"); err != nil {
+			t.Fatalf("Execute: %v", err)
+		}
+	}
+	if n := server.accepted.Load(); n != 1 {
+		t.Errorf("dialed %d times, want 1", n)
+	}
+
+	if _, err := pool.Execute(context.Background(), "game", server.addr, "wrong", "list"); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("changed password: err = %v, want ErrAuthFailed", err)
+	}
+	pool.Forget("game")
+}
+
+func TestPoolConcurrentDial(t *testing.T) {
+	server := newFakeServer(t, "secret", map[string][]string{"list": {"ok"}})
+	pool := NewPool(time.Second, time.Minute)
+	defer pool.Forget("game")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := pool.Execute(context.Background(), "game", server.addr, "secret", "list"); err != nil {
+				t.Errorf("Execute: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Connections that lost the race are closed; only the pooled one stays.
+	deadline := time.Now().Add(time.Second)
+	for server.open.Load() != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := server.open.Load(); n != 1 {
+		t.Errorf("%d connections open, want 1", n)
+	}
+}
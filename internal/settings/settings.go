@@ -1,25 +1,54 @@
 package settings
 
 type Settings struct {
-	UseTLS                 bool    `json:"useTLS"`
-	TLSCert                string  `json:"TLSCert"`
-	TLSKey                 string  `json:"TLSKey"`
-	HTTPPort               string  `json:"http_port"`
-	WorkerName             string  `json:"worker_name"`
-	LogLevel               string  `json:"log_level"`
-	MaxJobs                int     `json:"max_jobs"`
-	FsBasePath             string  `json:"fs_base_path"`
-	ReplayWindowSeconds    int     `json:"replay_window_seconds"`
-	RateLimitRPS           float64 `json:"rate_limit_rps"`
-	RateLimitBurst         int     `json:"rate_limit_burst"`
-	MaxArchiveRequestBytes int64   `json:"max_archive_request_bytes"`
-	MaxInlineWriteBytes    int64   `json:"max_inline_write_bytes"`
-	MaxUploadBytes         int64   `json:"max_upload_bytes"`
-	MaxUnzipBytes          int64   `json:"max_unzip_bytes"`
-	MaxZipEntries          int     `json:"max_zip_entries"`
-	RequireTLS             bool    `json:"require_tls"`
-	TrustProxyHeaders      bool    `json:"trust_proxy_headers"`
-	HealthRequiresAuth     bool    `json:"health_requires_auth"`
+	UseTLS                 bool     `json:"useTLS"`
+	TLSCert                string   `json:"TLSCert"`
+	TLSKey                 string   `json:"TLSKey"`
+	HTTPPort               string   `json:"http_port"`
+	WorkerName             string   `json:"worker_name"`
+	LogLevel               string   `json:"log_level"`
+	MaxJobs                int      `json:"max_jobs"`
+	FsBasePath             string   `json:"fs_base_path"`
+	ReplayWindowSeconds    int      `json:"replay_window_seconds"`
+	RateLimitRPS           float64  `json:"rate_limit_rps"`
+	RateLimitBurst         int      `json:"rate_limit_burst"`
+	MaxArchiveRequestBytes int64    `json:"max_archive_request_bytes"`
+	MaxInlineWriteBytes    int64    `json:"max_inline_write_bytes"`
+	MaxUploadBytes         int64    `json:"max_upload_bytes"`
+	MaxUnzipBytes          int64    `json:"max_unzip_bytes"`
+	MaxZipEntries          int      `json:"max_zip_entries"`
+	RequireTLS             bool     `json:"require_tls"`
+	TrustProxyHeaders      bool     `json:"trust_proxy_headers"`
+	HealthRequiresAuth     bool     `json:"health_requires_auth"`
+	DockerSocket           string   `json:"docker_socket"`
+	Runtime                string   `json:"runtime"`
+	PodmanSocket           string   `json:"podman_socket"`
+	ExecAllowedCommands    []string `json:"exec_allowed_commands"`
+	ExecTimeoutSeconds     int      `json:"exec_timeout_seconds"`
+	ExecAllowedUsers       []string `json:"exec_allowed_users"`
+	ExecAllowedWorkdirs    []string `json:"exec_allowed_workdirs"`
+	ExecAllowedEnv         []string `json:"exec_allowed_env"`
+	PortRangeTCP           string   `json:"port_range_tcp"`
+	PortRangeUDP           string   `json:"port_range_udp"`
+	PortStateFile          string   `json:"port_state_file"`
+	PolicyEnabled          bool     `json:"policy_enabled"`
+	PolicyAllowPrivileged  bool     `json:"policy_allow_privileged"`
+	PolicyAllowedCaps      []string `json:"policy_allowed_capabilities"`
+	PolicyAllowHostNetwork bool     `json:"policy_allow_host_network"`
+	PolicyAllowHostPID     bool     `json:"policy_allow_host_pid"`
+	PolicyAllowHostIPC     bool     `json:"policy_allow_host_ipc"`
+	PolicyAllowDevices     bool     `json:"policy_allow_devices"`
+	PolicyAllowUnconfined  bool     `json:"policy_allow_unconfined"`
+	PolicyAllowHostUserns  bool     `json:"policy_allow_host_userns"`
+	PolicyAllowHostCgroup  bool     `json:"policy_allow_host_cgroup"`
+	PolicyAllowCgParent    bool     `json:"policy_allow_cgroup_parent"`
+	PolicyAllowHostUTS     bool     `json:"policy_allow_host_uts"`
+	PolicyAllowContainerNS bool     `json:"policy_allow_container_namespaces"`
+	PolicyAllowVolumesFrom bool     `json:"policy_allow_volumes_from"`
+	PolicyAllowExtVolumes  bool     `json:"policy_allow_external_volumes"`
+	PolicyAllowedBindPaths []string `json:"policy_allowed_bind_paths"`
+	ResourceOverrideDir    string   `json:"resource_override_dir"`
+	ArchiveDir             string   `json:"archive_dir"`
 }
 
 func Default() Settings {
@@ -28,6 +57,7 @@ func Default() Settings {
 		TLSCert:                "",
 		TLSKey:                 "",
 		HTTPPort:               ":8031",
+		MaxJobs:                4,
 		FsBasePath:             "/etc/vestri/servers",
 		ReplayWindowSeconds:    300,
 		RateLimitRPS:           10,
@@ -40,5 +70,34 @@ func Default() Settings {
 		RequireTLS:             false,
 		TrustProxyHeaders:      false,
 		HealthRequiresAuth:     false,
+		DockerSocket:           "/var/run/docker.sock",
+		Runtime:                "docker",
+		PodmanSocket:           "",
+		ExecAllowedCommands:    []string{},
+		ExecTimeoutSeconds:     60,
+		ExecAllowedUsers:       []string{},
+		ExecAllowedWorkdirs:    []string{},
+		ExecAllowedEnv:         []string{},
+		PortRangeTCP:           "30000-30999",
+		PortRangeUDP:           "30000-30999",
+		PortStateFile:          "/etc/vestri/ports.json",
+		PolicyEnabled:          true,
+		PolicyAllowPrivileged:  false,
+		PolicyAllowedCaps:      []string{},
+		PolicyAllowHostNetwork: false,
+		PolicyAllowHostPID:     false,
+		PolicyAllowHostIPC:     false,
+		PolicyAllowDevices:     false,
+		PolicyAllowUnconfined:  false,
+		PolicyAllowHostUserns:  false,
+		PolicyAllowHostCgroup:  false,
+		PolicyAllowCgParent:    false,
+		PolicyAllowHostUTS:     false,
+		PolicyAllowContainerNS: false,
+		PolicyAllowVolumesFrom: false,
+		PolicyAllowExtVolumes:  false,
+		PolicyAllowedBindPaths: []string{},
+		ResourceOverrideDir:    "/etc/vestri/overrides",
+		ArchiveDir:             "/etc/vestri/archives",
 	}
 }
@@ -0,0 +1,127 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"vestri-worker/internal/http/fs"
+)
+
+const maxRenderSize = 10 << 20
+
+// funcs are available to .tmpl files. Values substituted into YAML should go
+// through yaml, as in `image: {{ yaml .Vars.IMAGE }}`, so that quotes, colons
+// and leading symbols cannot change the document's structure.
+var funcs = template.FuncMap{
+	"yaml": yamlQuote,
+}
+
+// RenderData is passed to .tmpl files.
+type RenderData struct {
+	Stack string
+	Vars  map[string]string
+}
+
+// Instantiate copies the template's files into dst, which must exist and be
+// empty. Symlinks and other special files in the template are rejected, and
+// a stack metadata file in the template is skipped since the worker writes
+// that itself.
+func (t *Template) Instantiate(dst string, data RenderData) error {
+	return filepath.WalkDir(t.dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(t.dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." || rel == ManifestName || rel == fs.StackMetaFileName {
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case !info.Mode().IsRegular():
+			return fmt.Errorf("template file %s is not a regular file", rel)
+		case strings.HasSuffix(rel, TemplateSuffix):
+			return renderFile(path, strings.TrimSuffix(target, TemplateSuffix), info.Mode().Perm(), data)
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+func renderFile(src, dst string, mode os.FileMode, data RenderData) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.Size() > maxRenderSize {
+		return fmt.Errorf("template file %s is too large", filepath.Base(src))
+	}
+	text, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.New(filepath.Base(src)).Option("missingkey=error").Funcs(funcs).Parse(string(text))
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(buf.Bytes()); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// yamlQuote returns value as a double-quoted YAML scalar. JSON strings are
+// valid YAML, so encoding/json does the escaping.
+func yamlQuote(value string) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
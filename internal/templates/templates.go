@@ -0,0 +1,336 @@
+// Package templates loads stack templates: directories holding a compose
+// file, .env defaults and config files next to a template.json manifest that
+// declares the variables a new stack is created with.
+package templates
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	ManifestName = "template.json"
+	// Files with this suffix are rendered with text/template and written
+	// without it; everything else is copied verbatim.
+	TemplateSuffix = ".tmpl"
+
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeBool   = "bool"
+	TypeEnum   = "enum"
+	TypePort   = "port"
+	TypeSecret = "secret"
+
+	defaultSecretLength = 24
+	maxSecretLength     = 128
+	secretAlphabet      = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+var (
+	ErrNotFound = errors.New("template not found")
+
+	validName     = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	validVariable = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+type Template struct {
+	Name        string     `json:"name"`
+	Title       string     `json:"title,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Variables   []Variable `json:"variables"`
+
+	dir string
+}
+
+type Variable struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Default     any      `json:"default,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+	Options     []string `json:"options,omitempty"`
+	Min         *int     `json:"min,omitempty"`
+	Max         *int     `json:"max,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Length      int      `json:"length,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// VariableError reports an invalid or missing variable value.
+type VariableError struct {
+	Variable string `json:"variable"`
+	Message  string `json:"message"`
+}
+
+func (e VariableError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Variable, e.Message)
+}
+
+// ValidationError collects every variable problem found in one request.
+type ValidationError struct {
+	Errors []VariableError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return "invalid variables: " + strings.Join(messages, "; ")
+}
+
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// List loads every valid template below dir. Broken templates are skipped so
+// that one bad upload does not hide the rest of the catalog.
+func List(dir string) ([]*Template, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Template{}, nil
+		}
+		return nil, err
+	}
+
+	list := []*Template{}
+	for _, entry := range entries {
+		if !entry.IsDir() || !validName.MatchString(entry.Name()) {
+			continue
+		}
+		t, err := Load(dir, entry.Name())
+		if err != nil {
+			continue
+		}
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func Load(dir, name string) (*Template, error) {
+	if !validName.MatchString(name) {
+		return nil, ErrNotFound
+	}
+	templateDir := filepath.Join(dir, name)
+
+	info, err := os.Lstat(templateDir)
+	if err != nil || !info.IsDir() {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(templateDir, ManifestName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var t Template
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ManifestName, err)
+	}
+	t.Name = name
+	t.dir = templateDir
+	if t.Variables == nil {
+		t.Variables = []Variable{}
+	}
+	if err := t.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ManifestName, err)
+	}
+	return &t, nil
+}
+
+func (t *Template) validate() error {
+	seen := make(map[string]bool)
+	for i := range t.Variables {
+		v := &t.Variables[i]
+		if !validVariable.MatchString(v.Name) {
+			return fmt.Errorf("invalid variable name %q", v.Name)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("duplicate variable %q", v.Name)
+		}
+		seen[v.Name] = true
+
+		switch v.Type {
+		case "":
+			v.Type = TypeString
+		case TypeString, TypeInt, TypeBool, TypePort, TypeSecret:
+		case TypeEnum:
+			if len(v.Options) == 0 {
+				return fmt.Errorf("variable %q: enum needs options", v.Name)
+			}
+		default:
+			return fmt.Errorf("variable %q: unknown type %q", v.Name, v.Type)
+		}
+		if v.Pattern != "" {
+			pattern, err := regexp.Compile("^(?:" + v.Pattern + ")$")
+			if err != nil {
+				return fmt.Errorf("variable %q: invalid pattern: %w", v.Name, err)
+			}
+			v.pattern = pattern
+		}
+		if v.Length < 0 || v.Length > maxSecretLength {
+			return fmt.Errorf("variable %q: length must be at most %d", v.Name, maxSecretLength)
+		}
+	}
+	return nil
+}
+
+// Resolve validates values against the declared variables, fills in
+// defaults and generates missing secrets. Values for undeclared variables are
+// rejected. The names of generated secrets are returned alongside.
+func (t *Template) Resolve(values map[string]string) (map[string]string, []string, error) {
+	resolved := make(map[string]string, len(t.Variables))
+	var (
+		generated []string
+		problems  []VariableError
+	)
+
+	declared := make(map[string]bool, len(t.Variables))
+	for _, v := range t.Variables {
+		declared[v.Name] = true
+	}
+	for name := range values {
+		if !declared[name] {
+			problems = append(problems, VariableError{Variable: name, Message: "unknown variable"})
+		}
+	}
+
+	for _, v := range t.Variables {
+		value, ok := values[v.Name]
+		if !ok || value == "" {
+			value, ok = v.defaultValue()
+		}
+		if (!ok || value == "") && v.Type == TypeSecret {
+			secret, err := generateSecret(v.Length)
+			if err != nil {
+				return nil, nil, err
+			}
+			value, ok = secret, true
+			generated = append(generated, v.Name)
+		}
+		if !ok || value == "" {
+			if v.Required {
+				problems = append(problems, VariableError{Variable: v.Name, Message: "value is required"})
+			}
+			resolved[v.Name] = ""
+			continue
+		}
+
+		if err := v.check(value); err != nil {
+			problems = append(problems, VariableError{Variable: v.Name, Message: err.Error()})
+			continue
+		}
+		resolved[v.Name] = value
+	}
+
+	if len(problems) > 0 {
+		sort.Slice(problems, func(i, j int) bool { return problems[i].Variable < problems[j].Variable })
+		return nil, nil, &ValidationError{Errors: problems}
+	}
+	return resolved, generated, nil
+}
+
+// Secrets returns the names of the template's secret variables.
+func (t *Template) Secrets() []string {
+	var names []string
+	for _, v := range t.Variables {
+		if v.Type == TypeSecret {
+			names = append(names, v.Name)
+		}
+	}
+	return names
+}
+
+func (v Variable) defaultValue() (string, bool) {
+	switch d := v.Default.(type) {
+	case nil:
+		return "", false
+	case string:
+		return d, true
+	case bool:
+		return strconv.FormatBool(d), true
+	case float64:
+		return strconv.FormatFloat(d, 'f', -1, 64), true
+	}
+	return fmt.Sprint(v.Default), true
+}
+
+func (v Variable) check(value string) error {
+	if strings.ContainsAny(value, "\r\n\x00") {
+		return errors.New("value must be a single line")
+	}
+
+	switch v.Type {
+	case TypeInt, TypePort:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("value must be an integer")
+		}
+		if v.Type == TypePort && (n < 1 || n > 65535) {
+			return errors.New("value must be a port between 1 and 65535")
+		}
+		if v.Min != nil && n < *v.Min {
+			return fmt.Errorf("value must be at least %d", *v.Min)
+		}
+		if v.Max != nil && n > *v.Max {
+			return fmt.Errorf("value must be at most %d", *v.Max)
+		}
+	case TypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return errors.New("value must be true or false")
+		}
+	case TypeEnum:
+		found := false
+		for _, option := range v.Options {
+			if value == option {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("value must be one of %s", strings.Join(v.Options, ", "))
+		}
+	case TypeString, TypeSecret:
+		if v.Min != nil && len(value) < *v.Min {
+			return fmt.Errorf("value must be at least %d characters", *v.Min)
+		}
+		if v.Max != nil && len(value) > *v.Max {
+			return fmt.Errorf("value must be at most %d characters", *v.Max)
+		}
+	}
+
+	if v.pattern != nil && !v.pattern.MatchString(value) {
+		return fmt.Errorf("value must match %s", v.Pattern)
+	}
+	return nil
+}
+
+func generateSecret(length int) (string, error) {
+	if length == 0 {
+		length = defaultSecretLength
+	}
+	max := big.NewInt(int64(len(secretAlphabet)))
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = secretAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}